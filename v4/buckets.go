@@ -0,0 +1,34 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+func validateBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return errors.New("histogram buckets must not be empty")
+	}
+	for i, bucket := range buckets {
+		if math.IsNaN(bucket) {
+			return errors.New("histogram bucket must not be NaN")
+		}
+		if i > 0 && bucket <= buckets[i-1] {
+			return errors.New(fmt.Sprintf("histogram buckets must be in increasing order: %v", buckets))
+		}
+	}
+	return nil
+}
+
+func equalBuckets(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package prometheus_metrics
+
+import (
+	"github.com/ifrolikov/prometheus_metrics/v4/naming"
+	"github.com/prometheus/client_golang/prometheus"
+	"runtime"
+	"runtime/debug"
+)
+
+const buildInfoMetricName = "build_info"
+
+var readBuildInfo = debug.ReadBuildInfo
+
+// WithBuildInfo registers the <namespace>_<subsystem>_build_info gauge set to 1 with labels describing the binary:
+// version of the main module, revision, goversion, dirty, and the passed fields.
+func WithBuildInfo(fields map[string]string) Option {
+	return func(c *Collector) error {
+		for labelName := range fields {
+			if err := naming.ValidateLabelName(labelName); err != nil {
+				return err
+			}
+		}
+		c.buildInfoFields = make(map[string]string, len(fields))
+		for labelName, value := range fields {
+			c.buildInfoFields[labelName] = value
+		}
+		return nil
+	}
+}
+
+func buildInfoLabels() map[string]string {
+	labels := map[string]string{
+		"version":   "unknown",
+		"revision":  "unknown",
+		"goversion": runtime.Version(),
+		"dirty":     "false",
+	}
+	info, ok := readBuildInfo()
+	if !ok {
+		return labels
+	}
+	if info.Main.Version != "" {
+		labels["version"] = info.Main.Version
+	}
+	addVCSBuildInfo(info, labels)
+	return labels
+}
+
+// registerBuildInfo registers the build info gauge. Const labels and the passed fields
+// take precedence over the labels read from the binary.
+func (c *Collector) registerBuildInfo() error {
+	constLabels := buildInfoLabels()
+	for labelName, value := range c.constLabels {
+		constLabels[labelName] = value
+	}
+	for labelName, value := range c.buildInfoFields {
+		constLabels[labelName] = value
+	}
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   c.namespace,
+		Subsystem:   c.subsystem,
+		Name:        buildInfoMetricName,
+		Help:        "Build information of the binary, the value is always 1.",
+		ConstLabels: constLabels,
+	})
+	gauge.Set(1)
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if err := c.register(gauge, buildInfoMetricName, MetricTypeGauge, nil); err != nil {
+		return err
+	}
+	c.buildInfo = gauge
+	return nil
+}
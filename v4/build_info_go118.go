@@ -0,0 +1,21 @@
+//go:build go1.18
+// +build go1.18
+
+package prometheus_metrics
+
+import "runtime/debug"
+
+// addVCSBuildInfo adds the Go version and the VCS settings stamped into binaries since Go 1.18.
+func addVCSBuildInfo(info *debug.BuildInfo, labels map[string]string) {
+	if info.GoVersion != "" {
+		labels["goversion"] = info.GoVersion
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			labels["revision"] = setting.Value
+		case "vcs.modified":
+			labels["dirty"] = setting.Value
+		}
+	}
+}
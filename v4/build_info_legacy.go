@@ -0,0 +1,9 @@
+//go:build !go1.18
+// +build !go1.18
+
+package prometheus_metrics
+
+import "runtime/debug"
+
+// addVCSBuildInfo does nothing, binaries built before Go 1.18 carry no VCS settings.
+func addVCSBuildInfo(info *debug.BuildInfo, labels map[string]string) {}
@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildInfoLabels(t *testing.T) {
+	defer func(read func() (*debug.BuildInfo, bool)) { readBuildInfo = read }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			GoVersion: "go1.99.1",
+			Main:      debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs", Value: "git"},
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.modified", Value: "true"},
+			},
+		}, true
+	}
+
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithConstLabels(map[string]string{"revision": "const", "region": "eu"}),
+		WithBuildInfo(map[string]string{"region": "us", "service": "api"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]string)
+	for _, mf := range mfs {
+		if mf.GetName() != "ns_sub_build_info" {
+			continue
+		}
+		if value := mf.Metric[0].GetGauge().GetValue(); value != 1 {
+			t.Errorf("build_info = %v, want 1", value)
+		}
+		for _, label := range mf.Metric[0].Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+	}
+	want := map[string]string{
+		"version":   "v1.2.3",
+		"goversion": "go1.99.1",
+		"dirty":     "true",
+		"revision":  "const",
+		"region":    "us",
+		"service":   "api",
+	}
+	for name, value := range want {
+		if labels[name] != value {
+			t.Errorf("label %s = %q, want %q", name, labels[name], value)
+		}
+	}
+}
+
+func TestBuildInfoLabelsWithoutBuildInfo(t *testing.T) {
+	defer func(read func() (*debug.BuildInfo, bool)) { readBuildInfo = read }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+
+	labels := buildInfoLabels()
+	if labels["version"] != "unknown" || labels["revision"] != "unknown" || labels["dirty"] != "false" {
+		t.Errorf("labels = %v, want unknown version and revision", labels)
+	}
+}
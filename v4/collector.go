@@ -1,11 +1,8 @@
 package prometheus_metrics
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
-	"sort"
 	"sync"
 	"time"
 )
@@ -13,31 +10,136 @@ import (
 var globalCollector *Collector
 
 type Collector struct {
-	podName                   string
-	timeMetricsMap            map[string]*prometheus.SummaryVec
-	timeMetricsLabelsMap      map[string][]string
-	counterMetricsMap         map[string]*prometheus.CounterVec
-	gaugeMetricsMap           map[string]*prometheus.GaugeVec
-	counterMetricsLabelsMap   map[string][]string
-	namespace                 string
-	subsystem                 string
-	mtx                       *sync.Mutex
-	grafanaDashboard          *string
-	histogramMetricsMap       map[string]*prometheus.HistogramVec
-	histogramMetricsLabelsMap map[string][]string
-	gaugeMetricsLabelsMap     map[string][]string
+	podName                  string
+	timeMetrics              readMostlyMap
+	counterMetrics           readMostlyMap
+	gaugeMetrics             readMostlyMap
+	namespace                string
+	subsystem                string
+	mtx                      *sync.Mutex
+	grafanaDashboard         *string
+	histogramMetrics         readMostlyMap
+	registerer               prometheus.Registerer
+	gatherer                 prometheus.Gatherer
+	defaultHistogramBuckets  []float64
+	histogramBucketsMap      map[string][]float64
+	defaultSummaryConfig     SummaryConfig
+	summaryConfigMap         map[string]SummaryConfig
+	timeUnit                 TimeUnit
+	definitionsMap           map[string]metricDefinition
+	unitMetricNames          readMostlyMap
+	unitDefinitionNames      map[string]string
+	strictDefinitions        bool
+	timerDurationMetrics     readMostlyMap
+	histogramDurationMetrics readMostlyMap
+	labelMismatchPolicy      LabelMismatchPolicy
+	separatedMetrics         readMostlyMap
+	missingLabelValue        string
+	labelMismatchCounter     counterVecValue
+	defaultMaxSeries         int
+	maxSeriesMap             map[string]int
+	maxTotalSeries           int64
+	totalSeries              int64
+	cardinalityOverflow      CardinalityOverflowPolicy
+	cardinalityOverflows     counterVecValue
+	defaultSeriesTTL         time.Duration
+	seriesTTLMap             map[string]time.Duration
+	clock                    Clock
+	janitorInterval          time.Duration
+	janitorStop              chan struct{}
+	janitorDone              chan struct{}
+	registeredNames          map[string]registeredName
+	sanitizeNames            bool
+	sanitizedNames           readMostlyMap
+	errorHandlers            []ErrorHandler
+	errorCounter             counterVecValue
+	countErrorsByMetric      bool
+	selfMetrics              *selfMetrics
+	selfMetricsNamespace     string
+	podNameLabel             string
+	extraConstLabels         map[string]string
+	constLabels              map[string]string
+	buildInfoFields          map[string]string
+	buildInfo                prometheus.Gauge
+	contextLabelNames        map[string][]string
+	pusher                   *pusher
+	remoteWriter             *remoteWriter
+	remoteWriteSent          counterVecValue
+	remoteWriteDropped       counterVecValue
 }
 
 func NewCollector(podName string, namespace string, subsystem string) *Collector {
 	collector := &Collector{
-		podName:   podName,
-		namespace: namespace,
-		subsystem: subsystem,
-		mtx:       &sync.Mutex{},
+		podName:                 podName,
+		namespace:               namespace,
+		subsystem:               subsystem,
+		mtx:                     &sync.Mutex{},
+		registerer:              prometheus.DefaultRegisterer,
+		gatherer:                prometheus.DefaultGatherer,
+		defaultHistogramBuckets: []float64{.1, .25, .5, .75, .85, 1, 1.5, 2, 2.5, 3, 4, 6, 8, 10},
+		histogramBucketsMap:     make(map[string][]float64),
+		defaultSummaryConfig: SummaryConfig{
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+		summaryConfigMap:    make(map[string]SummaryConfig),
+		definitionsMap:      make(map[string]metricDefinition),
+		unitDefinitionNames: make(map[string]string),
+		maxSeriesMap:        make(map[string]int),
+		seriesTTLMap:        make(map[string]time.Duration),
+		clock:               systemClock{},
+		janitorInterval:     time.Minute,
+		registeredNames:     make(map[string]registeredName),
+		podNameLabel:        defaultPodNameLabel,
+		extraConstLabels:    make(map[string]string),
+		contextLabelNames:   make(map[string][]string),
+		constLabels:         map[string]string{defaultPodNameLabel: podName},
 	}
 	return collector
 }
 
+func NewCollectorWithOptions(podName string, namespace string, subsystem string, options ...Option) (*Collector, error) {
+	collector := NewCollector(podName, namespace, subsystem)
+	for _, option := range options {
+		if err := option(collector); err != nil {
+			return nil, err
+		}
+	}
+	constLabels, err := collector.buildConstLabels()
+	if err != nil {
+		return nil, err
+	}
+	collector.constLabels = constLabels
+	if collector.selfMetricsNamespace != "" {
+		collector.selfMetrics = newSelfMetrics(collector, collector.selfMetricsNamespace)
+		if err := collector.registerer.Register(collector.selfMetrics); err != nil {
+			return nil, &RegistrationError{Name: "self metrics", Err: err}
+		}
+	}
+	if collector.buildInfoFields != nil {
+		if err := collector.registerBuildInfo(); err != nil {
+			return nil, err
+		}
+	}
+	if collector.pusher != nil {
+		collector.startPusher()
+	}
+	if collector.remoteWriter != nil {
+		collector.remoteWriter.start()
+	}
+	if collector.hasSeriesTTL() {
+		collector.startJanitor()
+	}
+	return collector, nil
+}
+
+func (c *Collector) Registerer() prometheus.Registerer {
+	return c.registerer
+}
+
+func (c *Collector) Gatherer() prometheus.Gatherer {
+	return c.gatherer
+}
+
 func GetGlobalCollector() *Collector {
 	return globalCollector
 }
@@ -48,211 +150,372 @@ func InitGlobalCollector(podName string, namespace string, subsystem string) *Co
 }
 
 func (c *Collector) ObserveTimer(name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveTimerDuration(name, time.Since(startTime), labels)
+}
+
+// ObserveTimerDuration records the duration in the unit chosen with WithTimeUnit.
+func (c *Collector) ObserveTimerDuration(name string, duration time.Duration, labels map[string]string) error {
+	return c.observe(name, labels, func(name string, labels map[string]string) error {
+		for _, metric := range c.durationMetrics(name, true) {
+			m, err := c.timer(name, metric.name, labels)
+			if err != nil {
+				return err
+			}
+			seriesLabels, err := c.admitSeries(name, m, labels, false)
+			if err != nil {
+				return err
+			}
+			m.vec.(*prometheus.SummaryVec).With(seriesLabels).Observe(metric.value(duration))
+		}
+		return nil
+	})
+}
+
+func (c *Collector) ObserveHistogram(name string, startTime time.Time, labels map[string]string) error {
+	return c.observeHistogram(name, time.Since(startTime), nil, labels)
+}
+
+// ObserveHistogramDuration records the duration in the unit chosen with WithTimeUnit.
+func (c *Collector) ObserveHistogramDuration(name string, duration time.Duration, labels map[string]string) error {
+	return c.observeHistogram(name, duration, nil, labels)
+}
+
+// ObserveHistogramWithBuckets works like ObserveHistogram but declares the bucket layout
+// of the metric if it is not known yet. A layout that differs from the declared one is rejected.
+func (c *Collector) ObserveHistogramWithBuckets(name string, startTime time.Time, buckets []float64, labels map[string]string) error {
+	return c.observeHistogram(name, time.Since(startTime), buckets, labels)
+}
+
+func (c *Collector) observeHistogram(name string, duration time.Duration, buckets []float64, labels map[string]string) error {
+	//todo push grafana graph
+	return c.observe(name, labels, func(name string, labels map[string]string) error {
+		for _, metric := range c.durationMetrics(name, false) {
+			m, err := c.histogram(name, metric.name, buckets, labels)
+			if err != nil {
+				return err
+			}
+			seriesLabels, err := c.admitSeries(name, m, labels, false)
+			if err != nil {
+				return err
+			}
+			m.vec.(*prometheus.HistogramVec).With(seriesLabels).Observe(metric.value(duration))
+		}
+		return nil
+	})
+}
+
+// DeclareHistogramBuckets sets the bucket layout used for the histogram when it is created.
+// Prometheus generators (prometheus.LinearBuckets, prometheus.ExponentialBuckets, ...) may be used to build the layout.
+func (c *Collector) DeclareHistogramBuckets(name string, buckets []float64) error {
+	name = c.sanitizeName(name)
 	defer c.mtx.Unlock()
 	c.mtx.Lock()
 
-	err := c.initTimerIfNotExist(name, labels)
-	if err != nil {
-		return err
-	}
-	c.timeMetricsMap[name].With(labels).Observe(float64(time.Since(startTime)))
-
-	return nil
+	return c.declareHistogramBuckets(name, buckets)
 }
 
-func (c *Collector) ObserveHistogram(name string, startTime time.Time, labels map[string]string) error {
+// DeclareSummaryConfig sets the summary objectives and decay window used for the timer when it is created.
+func (c *Collector) DeclareSummaryConfig(name string, config SummaryConfig) error {
+	name = c.sanitizeName(name)
 	defer c.mtx.Unlock()
 	c.mtx.Lock()
 
-	err := c.initHistogramIfNotExist(name, labels)
-	if err != nil {
+	return c.declareSummaryConfig(name, config)
+}
+
+func (c *Collector) declareSummaryConfig(name string, config SummaryConfig) error {
+	if err := validateSummaryConfig(config); err != nil {
 		return err
 	}
-	c.histogramMetricsMap[name].With(labels).Observe(time.Since(startTime).Seconds())
+	// Declared configs are stored without the defaults, so WithDefaultSummaryConfig applies
+	// regardless of the option order. The defaults are filled in when the timer is created.
+	config = config.copy()
+	if declaredConfig, ok := c.summaryConfigMap[name]; ok {
+		current := declaredConfig.withDefaults(c.defaultSummaryConfig)
+		requested := config.withDefaults(c.defaultSummaryConfig)
+		if !equalSummaryConfigs(current, requested) {
+			return &ConfigConflictError{Name: name, Setting: "summary config", Current: current, Requested: requested}
+		}
+		return nil
+	}
+	c.summaryConfigMap[name] = config
+	return nil
+}
 
-	//todo push grafana graph
+func (c *Collector) declareHistogramBuckets(name string, buckets []float64) error {
+	if err := validateBuckets(buckets); err != nil {
+		return err
+	}
+	if declaredBuckets, ok := c.histogramBucketsMap[name]; ok {
+		if !equalBuckets(declaredBuckets, buckets) {
+			return &ConfigConflictError{Name: name, Setting: "histogram buckets", Current: declaredBuckets, Requested: buckets}
+		}
+		return nil
+	}
+	c.histogramBucketsMap[name] = append([]float64(nil), buckets...)
 	return nil
 }
 
 func (c *Collector) ObserveCounter(name string, inc int, labels map[string]string) error {
-	defer c.mtx.Unlock()
-	c.mtx.Lock()
+	return c.ObserveCounterFloat(name, float64(inc), labels)
+}
 
-	err := c.initCounterIfNotExist(name, labels)
-	if err != nil {
+func (c *Collector) ObserveCounterFloat(name string, inc float64, labels map[string]string) error {
+	if inc < 0 {
+		err := fmt.Errorf("%w: %s by %v", ErrCounterDecrease, name, inc)
+		c.handleError(name, err)
 		return err
 	}
-	c.counterMetricsMap[name].With(labels).Add(float64(inc))
 
-	return nil
+	return c.observe(name, labels, func(name string, labels map[string]string) error {
+		m, err := c.counter(name, labels)
+		if err != nil {
+			return err
+		}
+		seriesLabels, err := c.admitSeries(name, m, labels, false)
+		if err != nil {
+			return err
+		}
+		m.vec.(*prometheus.CounterVec).With(seriesLabels).Add(inc)
+		return nil
+	})
 }
 
+// ObserveGauge sets the gauge to the passed value.
 func (c *Collector) ObserveGauge(name string, inc int, labels map[string]string) error {
-	defer c.mtx.Unlock()
-	c.mtx.Lock()
+	return c.SetGauge(name, float64(inc), labels)
+}
+
+func (c *Collector) SetGauge(name string, value float64, labels map[string]string) error {
+	return c.observeGauge(name, labels, func(gauge prometheus.Gauge) {
+		gauge.Set(value)
+	})
+}
+
+func (c *Collector) AddGauge(name string, value float64, labels map[string]string) error {
+	return c.observeGauge(name, labels, func(gauge prometheus.Gauge) {
+		gauge.Add(value)
+	})
+}
 
-	err := c.initGaugeIfNotExist(name, labels)
+func (c *Collector) SubGauge(name string, value float64, labels map[string]string) error {
+	return c.observeGauge(name, labels, func(gauge prometheus.Gauge) {
+		gauge.Sub(value)
+	})
+}
+
+func (c *Collector) IncGauge(name string, labels map[string]string) error {
+	return c.observeGauge(name, labels, func(gauge prometheus.Gauge) {
+		gauge.Inc()
+	})
+}
+
+func (c *Collector) DecGauge(name string, labels map[string]string) error {
+	return c.observeGauge(name, labels, func(gauge prometheus.Gauge) {
+		gauge.Dec()
+	})
+}
+
+func (c *Collector) SetGaugeToCurrentTime(name string, labels map[string]string) error {
+	return c.observeGauge(name, labels, func(gauge prometheus.Gauge) {
+		gauge.SetToCurrentTime()
+	})
+}
+
+func (c *Collector) observeGauge(name string, labels map[string]string, observe func(gauge prometheus.Gauge)) error {
+	return c.observe(name, labels, func(name string, labels map[string]string) error {
+		m, err := c.gauge(name, labels)
+		if err != nil {
+			return err
+		}
+		seriesLabels, err := c.admitSeries(name, m, labels, false)
+		if err != nil {
+			return err
+		}
+		observe(m.vec.(*prometheus.GaugeVec).With(seriesLabels))
+		return nil
+	})
+}
+
+// timer, histogram, counter and gauge look registered metrics up without locking;
+// the collector lock is taken only to register a metric for the first time.
+
+func (c *Collector) timer(name string, metricName string, labels map[string]string) (*metric, error) {
+	m, err := lookupMetric(&c.timeMetrics, metricName, labels)
+	if m == nil && err == nil {
+		m, err = c.registerLocked(func() (*metric, error) {
+			return c.initTimerIfNotExist(name, metricName, labels)
+		})
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	c.gaugeMetricsMap[name].With(labels).Set(float64(inc))
-	return nil
+	return m, nil
 }
 
-func (c *Collector) initTimerIfNotExist(name string, labels map[string]string) error {
-	if c.timeMetricsMap == nil {
-		c.timeMetricsMap = make(map[string]*prometheus.SummaryVec)
-		c.timeMetricsLabelsMap = make(map[string][]string)
+func (c *Collector) histogram(name string, metricName string, buckets []float64, labels map[string]string) (*metric, error) {
+	m, err := lookupMetric(&c.histogramMetrics, metricName, labels)
+	if m == nil && err == nil {
+		m, err = c.registerLocked(func() (*metric, error) {
+			return c.initHistogramIfNotExist(name, metricName, buckets, labels)
+		})
+	}
+	if err != nil {
+		return nil, err
 	}
+	if buckets != nil && !equalBuckets(m.buckets, buckets) {
+		return nil, &ConfigConflictError{Name: name, Setting: "histogram buckets", Current: m.buckets, Requested: buckets}
+	}
+	return m, nil
+}
 
-	var labelNames []string
-	if labels != nil {
-		for labelName := range labels {
-			labelNames = append(labelNames, labelName)
-		}
+func (c *Collector) counter(name string, labels map[string]string) (*metric, error) {
+	metricName := c.unitMetricName(name)
+	m, err := lookupMetric(&c.counterMetrics, metricName, labels)
+	if m == nil && err == nil {
+		m, err = c.registerLocked(func() (*metric, error) {
+			return c.initCounterIfNotExist(name, metricName, labels)
+		})
 	}
-	sort.Strings(labelNames)
-
-	if _, ok := c.timeMetricsMap[name]; !ok {
-		c.timeMetricsMap[name] = prometheus.NewSummaryVec(
-			prometheus.SummaryOpts{
-				Namespace:   c.namespace,
-				Subsystem:   c.subsystem,
-				Name:        name,
-				Help:        "dynamic metric " + name,
-				Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
-				ConstLabels: map[string]string{"podname": c.podName},
-			}, labelNames)
-		c.timeMetricsLabelsMap[name] = labelNames
-		prometheus.MustRegister(c.timeMetricsMap[name])
-	} else {
-		marshaledCurrentMetricLabels, _ := json.Marshal(c.timeMetricsLabelsMap[name])
-		marshaledRequestedMetricLabels, _ := json.Marshal(labelNames)
-		if string(marshaledCurrentMetricLabels) != string(marshaledRequestedMetricLabels) {
-			return errors.New(fmt.Sprintf("invalid metric labels:\n"+
-				"current labels: %s\n"+
-				"requested labels: %s",
-				marshaledCurrentMetricLabels,
-				marshaledRequestedMetricLabels))
-		}
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return m, nil
 }
 
-func (c *Collector) initHistogramIfNotExist(name string, labels map[string]string) error {
-	if c.histogramMetricsMap == nil {
-		c.histogramMetricsMap = make(map[string]*prometheus.HistogramVec)
-		c.histogramMetricsLabelsMap = make(map[string][]string)
+func (c *Collector) gauge(name string, labels map[string]string) (*metric, error) {
+	metricName := c.unitMetricName(name)
+	m, err := lookupMetric(&c.gaugeMetrics, metricName, labels)
+	if m == nil && err == nil {
+		m, err = c.registerLocked(func() (*metric, error) {
+			return c.initGaugeIfNotExist(name, metricName, labels)
+		})
 	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
 
-	var labelNames []string
-	if labels != nil {
-		for labelName := range labels {
-			labelNames = append(labelNames, labelName)
-		}
+func (c *Collector) initTimerIfNotExist(name string, metricName string, labels map[string]string) (*metric, error) {
+	if m, err := lookupMetric(&c.timeMetrics, metricName, labels); m != nil || err != nil {
+		return m, err
 	}
-	sort.Strings(labelNames)
-
-	if _, ok := c.histogramMetricsMap[name]; !ok {
-		c.histogramMetricsMap[name] = prometheus.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Namespace:   c.namespace,
-				Subsystem:   c.subsystem,
-				Name:        name,
-				Help:        "dynamic metric " + name,
-				Buckets:     []float64{.1, .25, .5, .75, .85, 1, 1.5, 2, 2.5, 3, 4, 6, 8, 10},
-				ConstLabels: map[string]string{"podname": c.podName},
-			}, labelNames)
-		c.histogramMetricsLabelsMap[name] = labelNames
-		prometheus.MustRegister(c.histogramMetricsMap[name])
-	} else {
-		marshaledCurrentMetricLabels, _ := json.Marshal(c.histogramMetricsLabelsMap[name])
-		marshaledRequestedMetricLabels, _ := json.Marshal(labelNames)
-		if string(marshaledCurrentMetricLabels) != string(marshaledRequestedMetricLabels) {
-			return errors.New(fmt.Sprintf("invalid metric labels:\n"+
-				"current labels: %s\n"+
-				"requested labels: %s",
-				marshaledCurrentMetricLabels,
-				marshaledRequestedMetricLabels))
+
+	labelNames := sortedLabelNames(labels)
+	definition, err := c.definition(MetricTypeTimer, name, labelNames)
+	if err != nil {
+		return nil, err
+	}
+	summaryConfig := c.summaryConfigMap[name].withDefaults(c.defaultSummaryConfig)
+	vec := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        metricName,
+			Help:        definition.help(metricName),
+			Objectives:  summaryConfig.Objectives,
+			MaxAge:      summaryConfig.MaxAge,
+			AgeBuckets:  summaryConfig.AgeBuckets,
+			BufCap:      summaryConfig.BufCap,
+			ConstLabels: c.constLabels,
+		}, labelNames)
+	if err := c.register(vec, metricName, MetricTypeTimer, labelNames); err != nil {
+		return nil, err
+	}
+	m := &metric{name: metricName, vec: vec, labelNames: labelNames, series: c.newSeriesSet(name, labelNames)}
+	c.timeMetrics.store(metricName, m)
+	c.summaryConfigMap[name] = summaryConfig
+	return m, nil
+}
+
+func (c *Collector) initHistogramIfNotExist(name string, metricName string, buckets []float64, labels map[string]string) (*metric, error) {
+	if buckets != nil {
+		if err := c.declareHistogramBuckets(name, buckets); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	if m, err := lookupMetric(&c.histogramMetrics, metricName, labels); m != nil || err != nil {
+		return m, err
+	}
+
+	labelNames := sortedLabelNames(labels)
+	definition, err := c.definition(MetricTypeHistogram, name, labelNames)
+	if err != nil {
+		return nil, err
+	}
+	histogramBuckets, ok := c.histogramBucketsMap[name]
+	if !ok {
+		histogramBuckets = c.defaultHistogramBuckets
+	}
+	vec := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        metricName,
+			Help:        definition.help(metricName),
+			Buckets:     histogramBuckets,
+			ConstLabels: c.constLabels,
+		}, labelNames)
+	if err := c.register(vec, metricName, MetricTypeHistogram, labelNames); err != nil {
+		return nil, err
+	}
+	m := &metric{name: metricName, vec: vec, labelNames: labelNames, buckets: histogramBuckets, series: c.newSeriesSet(name, labelNames)}
+	c.histogramMetrics.store(metricName, m)
+	c.histogramBucketsMap[name] = histogramBuckets
+	return m, nil
 }
 
-func (c *Collector) initCounterIfNotExist(name string, labels map[string]string) error {
-	if c.counterMetricsMap == nil {
-		c.counterMetricsMap = make(map[string]*prometheus.CounterVec)
-		c.counterMetricsLabelsMap = make(map[string][]string)
+func (c *Collector) initCounterIfNotExist(name string, metricName string, labels map[string]string) (*metric, error) {
+	if m, err := lookupMetric(&c.counterMetrics, metricName, labels); m != nil || err != nil {
+		return m, err
 	}
 
-	var labelNames []string
-	if labels != nil {
-		for labelName := range labels {
-			labelNames = append(labelNames, labelName)
-		}
+	name = c.unitDefinitionName(name, metricName)
+	labelNames := sortedLabelNames(labels)
+	definition, err := c.definition(MetricTypeCounter, name, labelNames)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(labelNames)
-
-	if _, ok := c.counterMetricsMap[name]; !ok {
-		c.counterMetricsMap[name] = prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Namespace:   c.namespace,
-				Subsystem:   c.subsystem,
-				Name:        name,
-				Help:        "dynamic metric " + name,
-				ConstLabels: map[string]string{"podname": c.podName},
-			}, labelNames)
-		c.counterMetricsLabelsMap[name] = labelNames
-		prometheus.MustRegister(c.counterMetricsMap[name])
-	} else {
-		marshaledCurrentMetricLabels, _ := json.Marshal(c.counterMetricsLabelsMap[name])
-		marshaledRequestedMetricLabels, _ := json.Marshal(labelNames)
-		if string(marshaledCurrentMetricLabels) != string(marshaledRequestedMetricLabels) {
-			return errors.New(fmt.Sprintf("invalid metric labels:\n"+
-				"current labels: %s\n"+
-				"requested labels: %s",
-				marshaledCurrentMetricLabels,
-				marshaledRequestedMetricLabels))
-		}
+	vec := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        metricName,
+			Help:        definition.help(metricName),
+			ConstLabels: c.constLabels,
+		}, labelNames)
+	if err := c.register(vec, metricName, MetricTypeCounter, labelNames); err != nil {
+		return nil, err
 	}
-	return nil
+	m := &metric{name: metricName, vec: vec, labelNames: labelNames, series: c.newSeriesSet(name, labelNames)}
+	c.counterMetrics.store(metricName, m)
+	return m, nil
 }
 
-func (c *Collector) initGaugeIfNotExist(name string, labels map[string]string) error {
-	if c.gaugeMetricsMap == nil {
-		c.gaugeMetricsMap = make(map[string]*prometheus.GaugeVec)
-		c.gaugeMetricsLabelsMap = make(map[string][]string)
+func (c *Collector) initGaugeIfNotExist(name string, metricName string, labels map[string]string) (*metric, error) {
+	if m, err := lookupMetric(&c.gaugeMetrics, metricName, labels); m != nil || err != nil {
+		return m, err
 	}
 
-	var labelNames []string
-	if labels != nil {
-		for labelName := range labels {
-			labelNames = append(labelNames, labelName)
-		}
+	name = c.unitDefinitionName(name, metricName)
+	labelNames := sortedLabelNames(labels)
+	definition, err := c.definition(MetricTypeGauge, name, labelNames)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(labelNames)
-
-	if _, ok := c.gaugeMetricsMap[name]; !ok {
-		c.gaugeMetricsMap[name] = prometheus.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Namespace:   c.namespace,
-				Subsystem:   c.subsystem,
-				Name:        name,
-				Help:        "dynamic metric " + name,
-				ConstLabels: map[string]string{"podname": c.podName},
-			}, labelNames)
-		c.gaugeMetricsLabelsMap[name] = labelNames
-		prometheus.MustRegister(c.gaugeMetricsMap[name])
-	} else {
-		marshaledCurrentMetricLabels, _ := json.Marshal(c.gaugeMetricsLabelsMap[name])
-		marshaledRequestedMetricLabels, _ := json.Marshal(labelNames)
-		if string(marshaledCurrentMetricLabels) != string(marshaledRequestedMetricLabels) {
-			return errors.New(fmt.Sprintf("invalid metric labels:\n"+
-				"current labels: %s\n"+
-				"requested labels: %s",
-				marshaledCurrentMetricLabels,
-				marshaledRequestedMetricLabels))
-		}
+	vec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        metricName,
+			Help:        definition.help(metricName),
+			ConstLabels: c.constLabels,
+		}, labelNames)
+	if err := c.register(vec, metricName, MetricTypeGauge, labelNames); err != nil {
+		return nil, err
 	}
-	return nil
+	m := &metric{name: metricName, vec: vec, labelNames: labelNames, series: c.newSeriesSet(name, labelNames)}
+	c.gaugeMetrics.store(metricName, m)
+	return m, nil
 }
@@ -0,0 +1,149 @@
+package prometheus_metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The benchmarks observe already registered metrics from many goroutines, which is the path kept
+// lock-free and allocation-free. Each one has a mutex sub-benchmark running the same observation
+// the way the collector did before: under the collector mutex, comparing label names marshaled to JSON.
+
+const benchmarkParallelism = 16
+
+func newBenchmarkCollector(b *testing.B) *Collector {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+// mutexBaseline is the observation path before the lock-free lookup, kept as the benchmark baseline.
+type mutexBaseline struct {
+	mtx        sync.Mutex
+	vecs       map[string]interface{}
+	labelNames map[string][]string
+}
+
+func newMutexBaseline() *mutexBaseline {
+	return &mutexBaseline{vecs: make(map[string]interface{}), labelNames: make(map[string][]string)}
+}
+
+func (m *mutexBaseline) observe(name string, labels map[string]string, newVec func(labelNames []string) interface{}, observe func(vec interface{})) error {
+	defer m.mtx.Unlock()
+	m.mtx.Lock()
+
+	var labelNames []string
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	vec, ok := m.vecs[name]
+	if !ok {
+		vec = newVec(labelNames)
+		m.vecs[name] = vec
+		m.labelNames[name] = labelNames
+	} else {
+		current, _ := json.Marshal(m.labelNames[name])
+		requested, _ := json.Marshal(labelNames)
+		if string(current) != string(requested) {
+			return errors.New("invalid metric labels")
+		}
+	}
+	observe(vec)
+	return nil
+}
+
+func runParallel(b *testing.B, observe func() error) {
+	b.SetParallelism(benchmarkParallelism)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := observe(); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkObserveCounterParallel(b *testing.B) {
+	labels := map[string]string{"route": "/users", "code": "200"}
+	b.Run("lock-free", func(b *testing.B) {
+		c := newBenchmarkCollector(b)
+		runParallel(b, func() error { return c.ObserveCounter("requests", 1, labels) })
+	})
+	b.Run("mutex", func(b *testing.B) {
+		m := newMutexBaseline()
+		newVec := func(labelNames []string) interface{} {
+			return prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests"}, labelNames)
+		}
+		runParallel(b, func() error {
+			return m.observe("requests", labels, newVec, func(vec interface{}) { vec.(*prometheus.CounterVec).With(labels).Add(1) })
+		})
+	})
+}
+
+func BenchmarkObserveTimerParallel(b *testing.B) {
+	labels := map[string]string{"route": "/users", "code": "200"}
+	b.Run("lock-free", func(b *testing.B) {
+		c := newBenchmarkCollector(b)
+		runParallel(b, func() error { return c.ObserveTimerDuration("latency", time.Millisecond, labels) })
+	})
+	b.Run("mutex", func(b *testing.B) {
+		m := newMutexBaseline()
+		newVec := func(labelNames []string) interface{} {
+			return prometheus.NewSummaryVec(prometheus.SummaryOpts{
+				Name:       "latency_seconds",
+				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			}, labelNames)
+		}
+		runParallel(b, func() error {
+			return m.observe("latency", labels, newVec, func(vec interface{}) {
+				vec.(*prometheus.SummaryVec).With(labels).Observe(time.Millisecond.Seconds())
+			})
+		})
+	})
+}
+
+func BenchmarkObserveHistogramParallel(b *testing.B) {
+	labels := map[string]string{"route": "/users", "code": "200"}
+	b.Run("lock-free", func(b *testing.B) {
+		c := newBenchmarkCollector(b)
+		runParallel(b, func() error { return c.ObserveHistogramDuration("latency", time.Millisecond, labels) })
+	})
+	b.Run("mutex", func(b *testing.B) {
+		m := newMutexBaseline()
+		newVec := func(labelNames []string) interface{} {
+			return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "latency_seconds"}, labelNames)
+		}
+		runParallel(b, func() error {
+			return m.observe("latency", labels, newVec, func(vec interface{}) {
+				vec.(*prometheus.HistogramVec).With(labels).Observe(time.Millisecond.Seconds())
+			})
+		})
+	})
+}
+
+func BenchmarkObserveGaugeParallel(b *testing.B) {
+	labels := map[string]string{"queue": "email"}
+	b.Run("lock-free", func(b *testing.B) {
+		c := newBenchmarkCollector(b)
+		runParallel(b, func() error { return c.SetGauge("depth", 1, labels) })
+	})
+	b.Run("mutex", func(b *testing.B) {
+		m := newMutexBaseline()
+		newVec := func(labelNames []string) interface{} {
+			return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "depth"}, labelNames)
+		}
+		runParallel(b, func() error {
+			return m.observe("depth", labels, newVec, func(vec interface{}) { vec.(*prometheus.GaugeVec).With(labels).Set(1) })
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ifrolikov/prometheus_metrics/v4/naming"
+	"os"
+)
+
+const defaultPodNameLabel = "podname"
+
+// Kubernetes downward API environment variables read by WithKubernetesEnvLabels.
+const (
+	EnvPodName      = "POD_NAME"
+	EnvPodNamespace = "POD_NAMESPACE"
+	EnvNodeName     = "NODE_NAME"
+)
+
+// WithConstLabels adds labels with the same value to every metric of the collector.
+func WithConstLabels(labels map[string]string) Option {
+	return func(c *Collector) error {
+		for labelName, value := range labels {
+			if err := naming.ValidateLabelName(labelName); err != nil {
+				return err
+			}
+			c.extraConstLabels[labelName] = value
+		}
+		return nil
+	}
+}
+
+// WithPodNameLabel renames the label the pod name is set to, podname by default.
+// An empty label name drops the label.
+func WithPodNameLabel(labelName string) Option {
+	return func(c *Collector) error {
+		if labelName != "" {
+			if err := naming.ValidateLabelName(labelName); err != nil {
+				return err
+			}
+		}
+		c.podNameLabel = labelName
+		return nil
+	}
+}
+
+// WithEnvConstLabels adds const labels from environment variables, mapping label names to variable names.
+// Variables that are not set or empty are skipped.
+func WithEnvConstLabels(envByLabel map[string]string) Option {
+	return func(c *Collector) error {
+		labels := make(map[string]string, len(envByLabel))
+		for labelName, env := range envByLabel {
+			if value := os.Getenv(env); value != "" {
+				labels[labelName] = value
+			}
+		}
+		return WithConstLabels(labels)(c)
+	}
+}
+
+// WithKubernetesEnvLabels populates const labels from the Kubernetes downward API:
+// the pod name from POD_NAME unless it is passed to the constructor,
+// namespace from POD_NAMESPACE and node from NODE_NAME.
+func WithKubernetesEnvLabels() Option {
+	return func(c *Collector) error {
+		if c.podName == "" {
+			c.podName = os.Getenv(EnvPodName)
+		}
+		return WithEnvConstLabels(map[string]string{
+			"namespace": EnvPodNamespace,
+			"node":      EnvNodeName,
+		})(c)
+	}
+}
+
+// buildConstLabels merges the pod name label with the other const labels.
+func (c *Collector) buildConstLabels() (map[string]string, error) {
+	constLabels := make(map[string]string, len(c.extraConstLabels)+1)
+	for labelName, value := range c.extraConstLabels {
+		constLabels[labelName] = value
+	}
+	if c.podNameLabel != "" {
+		if _, ok := constLabels[c.podNameLabel]; ok {
+			return nil, errors.New(fmt.Sprintf("const label %s conflicts with the pod name label", c.podNameLabel))
+		}
+		constLabels[c.podNameLabel] = c.podName
+	}
+	return constLabels, nil
+}
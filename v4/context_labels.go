@@ -0,0 +1,120 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"time"
+)
+
+type contextLabelsKey struct{}
+
+// ContextWithLabels returns a context carrying the labels merged with the ones already attached to ctx.
+// Context labels apply only to metrics that allow them with WithContextLabels.
+func ContextWithLabels(ctx context.Context, labels map[string]string) context.Context {
+	current := LabelsFromContext(ctx)
+	merged := make(map[string]string, len(current)+len(labels))
+	for labelName, value := range current {
+		merged[labelName] = value
+	}
+	for labelName, value := range labels {
+		merged[labelName] = value
+	}
+	return context.WithValue(ctx, contextLabelsKey{}, merged)
+}
+
+// LabelsFromContext returns the labels attached to ctx. The returned map must not be modified.
+func LabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(contextLabelsKey{}).(map[string]string)
+	return labels
+}
+
+// WithContextLabels allows Ctx observations of the metric to take the label names from the context.
+// Labels passed to the observation take precedence over context labels. The labels are always added,
+// with the WithMissingLabelValue value if the context does not have them, so the label names of the metric
+// do not depend on the context; observe such metrics with Ctx methods only.
+func WithContextLabels(name string, labelNames ...string) Option {
+	return func(c *Collector) error {
+		c.contextLabelNames[name] = append(c.contextLabelNames[name], labelNames...)
+		return nil
+	}
+}
+
+// contextLabels adds the labels allowed for the metric to the passed ones.
+// The allowlist is keyed by the sanitised name, like the other per-metric options.
+func (c *Collector) contextLabels(ctx context.Context, name string, labels map[string]string) map[string]string {
+	return MergeContextLabels(ctx, c.contextLabelNames[c.sanitizeName(name)], c.missingLabelValue, labels)
+}
+
+// MergeContextLabels adds the allowed label names to the labels, taking the values from ctx or missingValue
+// if ctx does not have them. The labels take precedence and are returned as is if they have all the allowed names.
+// Implementations of interfaces.Collector on other backends use it to treat context labels the same way.
+func MergeContextLabels(ctx context.Context, allowed []string, missingValue string, labels map[string]string) map[string]string {
+	if len(allowed) == 0 || hasLabels(labels, allowed) {
+		return labels
+	}
+	ctxLabels := LabelsFromContext(ctx)
+	merged := make(map[string]string, len(labels)+len(allowed))
+	for _, labelName := range allowed {
+		value, ok := ctxLabels[labelName]
+		if !ok {
+			value = missingValue
+		}
+		merged[labelName] = value
+	}
+	for labelName, value := range labels {
+		merged[labelName] = value
+	}
+	return merged
+}
+
+func hasLabels(labels map[string]string, labelNames []string) bool {
+	for _, labelName := range labelNames {
+		if _, ok := labels[labelName]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Collector) ObserveTimerCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveTimer(name, startTime, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveHistogramCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveHistogram(name, startTime, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveCounterCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return c.ObserveCounter(name, inc, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveCounterFloatCtx(ctx context.Context, name string, inc float64, labels map[string]string) error {
+	return c.ObserveCounterFloat(name, inc, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveGaugeCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return c.ObserveGauge(name, inc, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) SetGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.SetGauge(name, value, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) AddGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.AddGauge(name, value, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) SubGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.SubGauge(name, value, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) IncGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.IncGauge(name, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) DecGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.DecGauge(name, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) SetGaugeToCurrentTimeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.SetGaugeToCurrentTime(name, c.contextLabels(ctx, name, labels))
+}
@@ -0,0 +1,94 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestContextLabelsKeepTheLabelSetStable(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithContextLabels("requests", "tenant"),
+		WithMissingLabelValue("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"route": "/"}
+	withTenant := ContextWithLabels(context.Background(), map[string]string{"tenant": "acme", "user": "u1"})
+	if err := c.ObserveCounterCtx(withTenant, "requests", 1, labels); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounterCtx(context.Background(), "requests", 1, labels); err != nil {
+		t.Fatalf("observing without the context label: %v", err)
+	}
+	if err := c.ObserveCounterCtx(withTenant, "requests", 1, map[string]string{"route": "/", "tenant": "explicit"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := make(map[string]bool)
+	for _, mf := range mfs {
+		if mf.GetName() != "ns_sub_requests" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == "user" {
+					t.Errorf("a context label that is not allowed is observed: %v", m.Label)
+				}
+				if label.GetName() == "tenant" {
+					tenants[label.GetValue()] = true
+				}
+			}
+		}
+	}
+	if len(tenants) != 3 || !tenants["acme"] || !tenants["unknown"] || !tenants["explicit"] {
+		t.Errorf("tenants = %v, want acme, unknown and explicit", tenants)
+	}
+}
+
+func TestContextLabelsOfSanitizedNames(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithNameSanitization(),
+		WithContextLabels("get_user", "tenant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithLabels(context.Background(), map[string]string{"tenant": "acme"})
+	if err := c.ObserveCounterCtx(ctx, "GetUser", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := seriesValue(t, registry, "ns_sub_get_user", map[string]string{"tenant": "acme"}); !ok || value != 1 {
+		t.Errorf("get_user{tenant=acme} = %v, want the context label", value)
+	}
+}
+
+func TestMergeContextLabels(t *testing.T) {
+	ctx := ContextWithLabels(context.Background(), map[string]string{"tenant": "acme", "user": "u1"})
+	labels := map[string]string{"route": "/"}
+	merged := MergeContextLabels(ctx, []string{"tenant", "region"}, "none", labels)
+	want := map[string]string{"route": "/", "tenant": "acme", "region": "none"}
+	if len(merged) != len(want) {
+		t.Errorf("merged = %v, want %v", merged, want)
+	}
+	for labelName, value := range want {
+		if merged[labelName] != value {
+			t.Errorf("merged[%s] = %q, want %q", labelName, merged[labelName], value)
+		}
+	}
+	if len(labels) != 1 {
+		t.Errorf("labels were modified: %v", labels)
+	}
+
+	complete := map[string]string{"tenant": "explicit"}
+	if merged := MergeContextLabels(ctx, []string{"tenant"}, "none", complete); merged["tenant"] != "explicit" {
+		t.Errorf("merged = %v, want the passed label to win", merged)
+	}
+}
@@ -0,0 +1,238 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ifrolikov/prometheus_metrics/v4/naming"
+	"sort"
+	"strings"
+)
+
+type MetricType string
+
+const (
+	MetricTypeTimer     MetricType = "timer"
+	MetricTypeHistogram MetricType = "histogram"
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeGauge     MetricType = "gauge"
+	// MetricTypeUnknown describes metrics registered outside of the collector.
+	MetricTypeUnknown MetricType = "unknown"
+)
+
+// Definition declares a metric up front. Observations of a defined metric must use exactly
+// the declared label names. Unit is appended to the name of counters and gauges ("bytes" turns
+// "response_size" into "response_size_bytes"); timers and histograms are always in seconds.
+type Definition struct {
+	Name       string
+	Help       string
+	Unit       string
+	LabelNames []string
+	Buckets    []float64
+	Summary    *SummaryConfig
+}
+
+type metricDefinition struct {
+	metricType MetricType
+	Definition
+}
+
+func (d Definition) metricName() string {
+	if d.Unit == "" || strings.HasSuffix(d.Name, "_"+d.Unit) {
+		return d.Name
+	}
+	return d.Name + "_" + d.Unit
+}
+
+func (d Definition) help(metricName string) string {
+	if d.Help == "" {
+		return "dynamic metric " + metricName
+	}
+	return d.Help
+}
+
+func (c *Collector) DefineTimer(definition Definition) error {
+	return c.define(MetricTypeTimer, definition)
+}
+
+func (c *Collector) DefineHistogram(definition Definition) error {
+	return c.define(MetricTypeHistogram, definition)
+}
+
+func (c *Collector) DefineCounter(definition Definition) error {
+	return c.define(MetricTypeCounter, definition)
+}
+
+func (c *Collector) DefineGauge(definition Definition) error {
+	return c.define(MetricTypeGauge, definition)
+}
+
+func (c *Collector) define(metricType MetricType, definition Definition) error {
+	definition.Name = c.sanitizeName(definition.Name)
+	labelNames, err := c.sanitizeLabelNames(definition.LabelNames)
+	if err != nil {
+		return err
+	}
+	definition.LabelNames = labelNames
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if err := validateDefinition(metricType, definition); err != nil {
+		return err
+	}
+	definition.LabelNames = append([]string(nil), definition.LabelNames...)
+	sort.Strings(definition.LabelNames)
+
+	if declared, ok := c.definitionsMap[definition.Name]; ok {
+		if declared.metricType != metricType || !equalDefinitions(declared.Definition, definition) {
+			return &ConfigConflictError{
+				Name:      definition.Name,
+				Setting:   "definition",
+				Current:   fmt.Sprintf("%s %+v", declared.metricType, declared.Definition),
+				Requested: fmt.Sprintf("%s %+v", metricType, definition),
+			}
+		}
+		return nil
+	}
+	if c.isObserved(metricType, definition.Name) || c.isObserved(metricType, definition.metricName()) {
+		return fmt.Errorf("metric %s: %w", definition.Name, ErrAlreadyObserved)
+	}
+
+	if definition.Buckets != nil {
+		if err := c.declareHistogramBuckets(definition.Name, definition.Buckets); err != nil {
+			return err
+		}
+	}
+	if definition.Summary != nil {
+		if err := c.declareSummaryConfig(definition.Name, *definition.Summary); err != nil {
+			return err
+		}
+	}
+	c.definitionsMap[definition.Name] = metricDefinition{metricType: metricType, Definition: definition}
+	if metricName := definition.metricName(); metricName != definition.Name {
+		c.unitMetricNames.store(definition.Name, metricName)
+		c.unitDefinitionNames[metricName] = definition.Name
+	}
+	return nil
+}
+
+// unitMetricName returns the registered name of a counter or gauge defined with a unit,
+// which is also the key the metric is stored under. Other names are returned as is.
+func (c *Collector) unitMetricName(name string) string {
+	if metricName, ok := c.unitMetricNames.load(name); ok {
+		return metricName.(string)
+	}
+	return name
+}
+
+// unitDefinitionName returns the defined name of the metric observed by its name with the unit.
+func (c *Collector) unitDefinitionName(name string, metricName string) string {
+	if definitionName, ok := c.unitDefinitionNames[metricName]; ok {
+		return definitionName
+	}
+	return name
+}
+
+// definition returns the declared definition of the metric checked against the requested labels.
+// Metrics without a definition get an implicit one unless the collector is strict.
+func (c *Collector) definition(metricType MetricType, name string, labelNames []string) (Definition, error) {
+	declared, ok := c.definitionsMap[name]
+	if !ok {
+		if c.strictDefinitions {
+			return Definition{}, fmt.Errorf("metric %s: %w", name, ErrNotDefined)
+		}
+		return Definition{Name: name}, nil
+	}
+	if declared.metricType != metricType {
+		return Definition{}, &NameCollisionError{
+			Name:                name,
+			RequestedType:       metricType,
+			RequestedLabelNames: labelNames,
+			ExistingType:        declared.metricType,
+			ExistingLabelNames:  declared.LabelNames,
+		}
+	}
+	if !equalLabelNames(declared.LabelNames, labelNames) {
+		return Definition{}, &LabelMismatchError{
+			Name:               name,
+			ExpectedLabelNames: declared.LabelNames,
+			GotLabelNames:      labelNames,
+			Defined:            true,
+		}
+	}
+	return declared.Definition, nil
+}
+
+func (c *Collector) isObserved(metricType MetricType, name string) bool {
+	switch metricType {
+	case MetricTypeTimer:
+		_, legacyOk := c.timeMetrics.load(name)
+		_, secondsOk := c.timeMetrics.load(secondsMetricName(name))
+		return legacyOk || secondsOk
+	case MetricTypeHistogram:
+		_, legacyOk := c.histogramMetrics.load(name)
+		_, secondsOk := c.histogramMetrics.load(secondsMetricName(name))
+		return legacyOk || secondsOk
+	case MetricTypeCounter:
+		_, ok := c.counterMetrics.load(name)
+		return ok
+	case MetricTypeGauge:
+		_, ok := c.gaugeMetrics.load(name)
+		return ok
+	}
+	return false
+}
+
+func validateDefinition(metricType MetricType, definition Definition) error {
+	if err := naming.ValidateMetricName(definition.Name); err != nil {
+		return err
+	}
+	if definition.Help == "" {
+		return errors.New(fmt.Sprintf("metric %s must have help text", definition.Name))
+	}
+	if definition.Buckets != nil && metricType != MetricTypeHistogram {
+		return errors.New(fmt.Sprintf("buckets are allowed only for histograms, %s is %s", definition.Name, metricType))
+	}
+	if definition.Summary != nil && metricType != MetricTypeTimer {
+		return errors.New(fmt.Sprintf("summary config is allowed only for timers, %s is %s", definition.Name, metricType))
+	}
+	if (metricType == MetricTypeTimer || metricType == MetricTypeHistogram) &&
+		definition.Unit != "" && definition.Unit != strings.TrimPrefix(secondsSuffix, "_") {
+		return errors.New(fmt.Sprintf("%s %s is measured in seconds, unit %s is not supported", metricType, definition.Name, definition.Unit))
+	}
+	for i, labelName := range definition.LabelNames {
+		if err := naming.ValidateLabelName(labelName); err != nil {
+			return err
+		}
+		for _, otherLabelName := range definition.LabelNames[:i] {
+			if labelName == otherLabelName {
+				return &InvalidNameError{Name: labelName, Label: true, Reason: fmt.Sprintf("is duplicated in metric %s", definition.Name)}
+			}
+		}
+	}
+	return nil
+}
+
+func equalDefinitions(a Definition, b Definition) bool {
+	if a.Name != b.Name || a.Help != b.Help || a.Unit != b.Unit || !equalLabelNames(a.LabelNames, b.LabelNames) {
+		return false
+	}
+	if (a.Buckets == nil) != (b.Buckets == nil) || !equalBuckets(a.Buckets, b.Buckets) {
+		return false
+	}
+	if (a.Summary == nil) != (b.Summary == nil) {
+		return false
+	}
+	return a.Summary == nil || equalSummaryConfigs(*a.Summary, *b.Summary)
+}
+
+func equalLabelNames(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestDefinedUnitIsPartOfTheMetricName(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DefineCounter(Definition{Name: "resp", Help: "response size", Unit: "bytes", LabelNames: []string{"route"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{"route": "/"}
+	if err := c.ObserveCounter("resp_bytes", 2, labels); err != nil {
+		t.Fatalf("observing by the name with the unit: %v", err)
+	}
+	if err := c.ObserveCounter("resp", 3, labels); err != nil {
+		t.Fatalf("observing by the defined name: %v", err)
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "ns_sub_resp_bytes" || mfs[0].GetHelp() != "response size" {
+		t.Fatalf("gathered %v, want a single ns_sub_resp_bytes with the defined help", mfs)
+	}
+	if value := mfs[0].Metric[0].GetCounter().GetValue(); value != 5 {
+		t.Errorf("counter = %v, want 5", value)
+	}
+
+	if err := c.ObserveCounter("resp_bytes", 1, nil); err == nil {
+		t.Error("the name with the unit must keep the defined label names")
+	}
+	if err := c.Unregister("resp"); err != nil {
+		t.Errorf("unregistering by the defined name: %v", err)
+	}
+}
+
+func TestDefineAfterObservingTheNameWithTheUnit(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetGauge("queue_items", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DefineGauge(Definition{Name: "queue", Help: "queue length", Unit: "items"}); err == nil {
+		t.Error("defining a gauge already observed under its name with the unit must fail")
+	}
+}
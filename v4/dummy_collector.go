@@ -1,11 +1,11 @@
 package prometheus_metrics
 
 import (
+	"context"
 	"time"
 )
 
 type DummyCollector struct {
-
 }
 
 func NewDummyCollector() *DummyCollector {
@@ -16,7 +16,86 @@ func (d DummyCollector) ObserveTimer(name string, startTime time.Time, labels ma
 	return nil
 }
 
+func (d DummyCollector) ObserveHistogram(name string, startTime time.Time, labels map[string]string) error {
+	return nil
+}
+
 func (d DummyCollector) ObserveCounter(name string, inc int, labels map[string]string) error {
 	return nil
 }
 
+func (d DummyCollector) ObserveCounterFloat(name string, inc float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) ObserveGauge(name string, inc int, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) SetGauge(name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) AddGauge(name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) SubGauge(name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) IncGauge(name string, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) DecGauge(name string, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) SetGaugeToCurrentTime(name string, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) ObserveTimerCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) ObserveHistogramCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) ObserveCounterCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) ObserveCounterFloatCtx(ctx context.Context, name string, inc float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) ObserveGaugeCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) SetGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) AddGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) SubGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) IncGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) DecGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return nil
+}
+
+func (d DummyCollector) SetGaugeToCurrentTimeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return nil
+}
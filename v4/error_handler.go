@@ -0,0 +1,124 @@
+package prometheus_metrics
+
+import "errors"
+
+// ErrorHandler is called with the metric name on every failed observation.
+// It is called synchronously from the observing goroutine and must not block.
+type ErrorHandler func(name string, err error)
+
+// Logger is satisfied by *log.Logger and most structured logger adapters.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Error kinds reported by ErrorKind.
+const (
+	ErrorKindLabelMismatch   = "label_mismatch"
+	ErrorKindNameCollision   = "name_collision"
+	ErrorKindRegistration    = "registration"
+	ErrorKindCardinality     = "cardinality_limit"
+	ErrorKindInvalidName     = "invalid_name"
+	ErrorKindConfigConflict  = "config_conflict"
+	ErrorKindCounterDecrease = "counter_decrease"
+	ErrorKindNotDefined      = "not_defined"
+	ErrorKindOther           = "other"
+)
+
+// ErrorKind classifies collector errors for metrics and logs.
+func ErrorKind(err error) string {
+	var (
+		labelMismatch *LabelMismatchError
+		nameCollision *NameCollisionError
+		registration  *RegistrationError
+		cardinality   *CardinalityLimitError
+		invalidName   *InvalidNameError
+		conflict      *ConfigConflictError
+	)
+	switch {
+	case errors.As(err, &labelMismatch):
+		return ErrorKindLabelMismatch
+	case errors.As(err, &nameCollision):
+		return ErrorKindNameCollision
+	case errors.As(err, &registration):
+		return ErrorKindRegistration
+	case errors.As(err, &cardinality):
+		return ErrorKindCardinality
+	case errors.As(err, &invalidName):
+		return ErrorKindInvalidName
+	case errors.As(err, &conflict):
+		return ErrorKindConfigConflict
+	case errors.Is(err, ErrCounterDecrease):
+		return ErrorKindCounterDecrease
+	case errors.Is(err, ErrNotDefined):
+		return ErrorKindNotDefined
+	}
+	return ErrorKindOther
+}
+
+// WithErrorHandler adds a handler called on every failed observation. Handlers are called in the order they are added.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(c *Collector) error {
+		if handler == nil {
+			return errors.New("error handler must not be nil")
+		}
+		c.errorHandlers = append(c.errorHandlers, handler)
+		return nil
+	}
+}
+
+// WithErrorCounter counts failed observations in <namespace>_<subsystem>_observation_errors_total{metric, kind}.
+// With WithSelfMetrics the metric label is added to the self metrics observation_errors_total instead.
+func WithErrorCounter() Option {
+	return func(c *Collector) error {
+		c.countErrorsByMetric = true
+		c.errorHandlers = append(c.errorHandlers, c.countError)
+		return nil
+	}
+}
+
+// WithErrorLogger logs failed observations with the logger.
+func WithErrorLogger(logger Logger) Option {
+	return func(c *Collector) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		c.errorHandlers = append(c.errorHandlers, func(name string, err error) {
+			logger.Printf("prometheus_metrics: %s observation failed (%s): %s", name, ErrorKind(err), err)
+		})
+		return nil
+	}
+}
+
+// observe runs the observation under the label mismatch policy and reports its failure to the error handlers.
+func (c *Collector) observe(name string, labels map[string]string, observe func(name string, labels map[string]string) error) error {
+	err := c.observeWithLabelPolicy(name, labels, observe)
+	if err != nil {
+		c.handleError(name, err)
+	}
+	return err
+}
+
+func (c *Collector) handleError(name string, err error) {
+	if c.selfMetrics != nil {
+		if c.countErrorsByMetric {
+			c.selfMetrics.errors.WithLabelValues(name, ErrorKind(err)).Inc()
+		} else {
+			c.selfMetrics.errors.WithLabelValues(ErrorKind(err)).Inc()
+		}
+	}
+	for _, handler := range c.errorHandlers {
+		handler(name, err)
+	}
+}
+
+func (c *Collector) countError(name string, err error) {
+	if c.selfMetrics != nil {
+		// Counted by handleError in the self metrics.
+		return
+	}
+	counter := c.selfCounter(&c.errorCounter, "observation_errors_total",
+		"Failed observations by metric and error kind.", []string{"metric", "kind"})
+	if counter != nil {
+		counter.WithLabelValues(name, ErrorKind(err)).Inc()
+	}
+}
@@ -0,0 +1,254 @@
+package prometheus_metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"strings"
+)
+
+var (
+	// ErrCounterDecrease is returned when a counter is given a negative increment.
+	ErrCounterDecrease = errors.New("counter cannot decrease")
+	// ErrNotDefined is returned by a strict collector for metrics without a definition.
+	ErrNotDefined = errors.New("metric is not defined")
+	// ErrAlreadyObserved is returned when a metric is defined after it was observed.
+	ErrAlreadyObserved = errors.New("metric is already observed and cannot be defined")
+	// ErrNotRegistered is returned when removing a metric the collector does not own.
+	ErrNotRegistered = errors.New("metric is not registered")
+)
+
+// LabelMismatchError is returned when the observed label names differ from the label names
+// the metric was registered or defined with.
+type LabelMismatchError struct {
+	Name               string
+	ExpectedLabelNames []string
+	GotLabelNames      []string
+	// Defined reports that the expected label names come from the metric definition.
+	Defined bool
+}
+
+func (e *LabelMismatchError) Error() string {
+	kind := "current"
+	if e.Defined {
+		kind = "defined"
+	}
+	marshaledCurrentMetricLabels, _ := json.Marshal(e.ExpectedLabelNames)
+	marshaledRequestedMetricLabels, _ := json.Marshal(e.GotLabelNames)
+	return fmt.Sprintf("invalid metric labels for %s:\n"+
+		"%s labels: %s\n"+
+		"requested labels: %s",
+		e.Name,
+		kind,
+		marshaledCurrentMetricLabels,
+		marshaledRequestedMetricLabels)
+}
+
+// RegistrationError is returned when the registry refuses a metric for a reason
+// other than a name collision.
+type RegistrationError struct {
+	Name string
+	Err  error
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("metric %s registration failed: %s", e.Name, e.Err)
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// CardinalityLimitError is returned for a new label tuple over the series limit
+// when the overflow policy is CardinalityOverflowReject.
+type CardinalityLimitError struct {
+	Name  string
+	Limit int64
+	// CollectorWide reports that the limit set by WithMaxTotalSeries was reached, not the metric one.
+	CollectorWide bool
+}
+
+func (e *CardinalityLimitError) Error() string {
+	if e.CollectorWide {
+		return fmt.Sprintf("metric %s reached the collector series limit %d", e.Name, e.Limit)
+	}
+	return fmt.Sprintf("metric %s reached the series limit %d", e.Name, e.Limit)
+}
+
+// ConfigConflictError is returned when a metric setting (buckets, summary config or definition)
+// is requested different from the one already in use.
+type ConfigConflictError struct {
+	Name      string
+	Setting   string
+	Current   interface{}
+	Requested interface{}
+}
+
+func (e *ConfigConflictError) Error() string {
+	return fmt.Sprintf("invalid %s for %s:\n"+
+		"current %s: %+v\n"+
+		"requested %s: %+v",
+		e.Setting, e.Name,
+		e.Setting, e.Current,
+		e.Setting, e.Requested)
+}
+
+// NameCollisionError is returned when a metric name is already taken by a metric of another type
+// or with other labels, either in the collector or in its registry.
+type NameCollisionError struct {
+	Name                string
+	RequestedType       MetricType
+	RequestedLabelNames []string
+	// ExistingType is MetricTypeUnknown for a metric registered outside of the collector without series.
+	ExistingType MetricType
+	// ExistingLabelNames is known only for metrics registered by the collector itself,
+	// metrics registered outside of it are described by ExistingDescription.
+	ExistingLabelNames  []string
+	ExistingDescription string
+	Err                 error
+}
+
+func (e *NameCollisionError) Error() string {
+	existing := fmt.Sprintf("%s with labels %v", e.ExistingType, e.ExistingLabelNames)
+	if e.ExistingDescription != "" {
+		existing = fmt.Sprintf("%s %s", e.ExistingType, e.ExistingDescription)
+	} else if e.Err != nil {
+		existing = fmt.Sprintf("%s metric outside of the collector (%s)", e.ExistingType, e.Err)
+	}
+	return fmt.Sprintf("metric %s cannot be registered as %s with labels %v: already registered as %s",
+		e.Name, e.RequestedType, e.RequestedLabelNames, existing)
+}
+
+func (e *NameCollisionError) Unwrap() error {
+	return e.Err
+}
+
+type registeredName struct {
+	metricType MetricType
+	labelNames []string
+}
+
+// register registers the metric vec keeping the collector-wide name index of all metric types.
+func (c *Collector) register(vec prometheus.Collector, metricName string, metricType MetricType, labelNames []string) error {
+	if err := c.validateNames(metricName, labelNames); err != nil {
+		return err
+	}
+	if existing, ok := c.registeredNames[metricName]; ok {
+		return &NameCollisionError{
+			Name:                metricName,
+			RequestedType:       metricType,
+			RequestedLabelNames: labelNames,
+			ExistingType:        existing.metricType,
+			ExistingLabelNames:  existing.labelNames,
+		}
+	}
+
+	if err := c.registerer.Register(vec); err != nil {
+		collision := &NameCollisionError{
+			Name:                metricName,
+			RequestedType:       metricType,
+			RequestedLabelNames: labelNames,
+			ExistingType:        MetricTypeUnknown,
+			Err:                 err,
+		}
+		if alreadyRegistered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			collision.ExistingType = collectorMetricType(alreadyRegistered.ExistingCollector)
+			collision.ExistingDescription = describeCollector(alreadyRegistered.ExistingCollector)
+			return collision
+		}
+		// the registry reports other name collisions with plain errors only
+		if strings.Contains(err.Error(), "same fully-qualified name") {
+			collision.ExistingType = c.gatheredMetricType(metricName)
+			return collision
+		}
+		return &RegistrationError{Name: metricName, Err: err}
+	}
+	c.registeredNames[metricName] = registeredName{metricType: metricType, labelNames: labelNames}
+	if c.selfMetrics != nil {
+		c.selfMetrics.registrations.WithLabelValues(string(metricType)).Inc()
+	}
+	return nil
+}
+
+// collectorMetricType reads the type from a collected metric, the interfaces of plain metrics overlap:
+// a Gauge is a Counter too and a Summary has the methods of a Histogram. Vecs without series are told apart
+// by their concrete types.
+func collectorMetricType(collector prometheus.Collector) MetricType {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	metricType := MetricTypeUnknown
+	for m := range metrics {
+		var out dto.Metric
+		if metricType != MetricTypeUnknown || m.Write(&out) != nil {
+			continue
+		}
+		switch {
+		case out.Summary != nil:
+			metricType = MetricTypeTimer
+		case out.Histogram != nil:
+			metricType = MetricTypeHistogram
+		case out.Counter != nil:
+			metricType = MetricTypeCounter
+		case out.Gauge != nil:
+			metricType = MetricTypeGauge
+		}
+	}
+	if metricType != MetricTypeUnknown {
+		return metricType
+	}
+
+	switch collector.(type) {
+	case *prometheus.SummaryVec:
+		return MetricTypeTimer
+	case *prometheus.HistogramVec:
+		return MetricTypeHistogram
+	case *prometheus.CounterVec:
+		return MetricTypeCounter
+	case *prometheus.GaugeVec:
+		return MetricTypeGauge
+	}
+	return MetricTypeUnknown
+}
+
+// gatheredMetricType finds the type of the metric registered outside of the collector in the gathered
+// metrics, it is unknown until the metric has a series.
+func (c *Collector) gatheredMetricType(metricName string) MetricType {
+	fqName := prometheus.BuildFQName(c.namespace, c.subsystem, metricName)
+	mfs, _ := c.gatherer.Gather()
+	for _, mf := range mfs {
+		if mf.GetName() != fqName {
+			continue
+		}
+		switch mf.GetType() {
+		case dto.MetricType_SUMMARY:
+			return MetricTypeTimer
+		case dto.MetricType_HISTOGRAM:
+			return MetricTypeHistogram
+		case dto.MetricType_COUNTER:
+			return MetricTypeCounter
+		case dto.MetricType_GAUGE:
+			return MetricTypeGauge
+		}
+	}
+	return MetricTypeUnknown
+}
+
+func describeCollector(collector prometheus.Collector) string {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(descs)
+		close(descs)
+	}()
+
+	var descriptions []string
+	for desc := range descs {
+		descriptions = append(descriptions, desc.String())
+	}
+	return strings.Join(descriptions, ", ")
+}
@@ -0,0 +1,144 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+	"testing"
+)
+
+func TestNameCollisionWithinCollector(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("jobs", 1, map[string]string{"queue": "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.SetGauge("jobs", 1, nil)
+	var collision *NameCollisionError
+	if !errors.As(err, &collision) {
+		t.Fatalf("err = %v, want a NameCollisionError", err)
+	}
+	if collision.RequestedType != MetricTypeGauge || collision.ExistingType != MetricTypeCounter {
+		t.Errorf("collision = %s over %s, want gauge over counter", collision.RequestedType, collision.ExistingType)
+	}
+	if len(collision.ExistingLabelNames) != 1 || collision.ExistingLabelNames[0] != "queue" {
+		t.Errorf("existing labels = %v, want the observed ones", collision.ExistingLabelNames)
+	}
+}
+
+func TestNameCollisionWithExternalMetrics(t *testing.T) {
+	opts := func(name string) prometheus.Opts {
+		return prometheus.Opts{Namespace: "ns", Subsystem: "sub", Name: name, Help: "External."}
+	}
+	for _, test := range []struct {
+		name         string
+		external     prometheus.Collector
+		observe      func(c *Collector) error
+		existingType MetricType
+	}{
+		{
+			name:         "histogram",
+			external:     prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "ns", Subsystem: "sub", Name: "histogram", Help: "External."}),
+			observe:      func(c *Collector) error { return c.ObserveCounter("histogram", 1, nil) },
+			existingType: MetricTypeHistogram,
+		},
+		{
+			name:         "summary",
+			external:     prometheus.NewSummary(prometheus.SummaryOpts{Namespace: "ns", Subsystem: "sub", Name: "summary", Help: "External."}),
+			observe:      func(c *Collector) error { return c.ObserveCounter("summary", 1, nil) },
+			existingType: MetricTypeTimer,
+		},
+		{
+			name:         "gauge",
+			external:     prometheus.NewGauge(prometheus.GaugeOpts(opts("gauge"))),
+			observe:      func(c *Collector) error { return c.ObserveCounter("gauge", 1, nil) },
+			existingType: MetricTypeGauge,
+		},
+		{
+			name:         "counter",
+			external:     prometheus.NewCounter(prometheus.CounterOpts(opts("counter"))),
+			observe:      func(c *Collector) error { return c.SetGauge("counter", 1, nil) },
+			existingType: MetricTypeCounter,
+		},
+		{
+			name:         "counter vec",
+			external:     counterVecWithSeries(prometheus.CounterOpts(opts("vec"))),
+			observe:      func(c *Collector) error { return c.SetGauge("vec", 1, nil) },
+			existingType: MetricTypeCounter,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			registry.MustRegister(test.external)
+
+			err = test.observe(c)
+			var collision *NameCollisionError
+			if !errors.As(err, &collision) {
+				t.Fatalf("err = %v, want a NameCollisionError", err)
+			}
+			if collision.ExistingType != test.existingType {
+				t.Errorf("existing type = %s, want %s", collision.ExistingType, test.existingType)
+			}
+		})
+	}
+}
+
+func counterVecWithSeries(opts prometheus.CounterOpts) prometheus.Collector {
+	vec := prometheus.NewCounterVec(opts, []string{"queue"})
+	vec.WithLabelValues("a").Inc()
+	return vec
+}
+
+func TestCollectorMetricType(t *testing.T) {
+	for _, test := range []struct {
+		collector prometheus.Collector
+		want      MetricType
+	}{
+		{prometheus.NewSummary(prometheus.SummaryOpts{Name: "summary", Help: "Summary."}), MetricTypeTimer},
+		{prometheus.NewHistogram(prometheus.HistogramOpts{Name: "histogram", Help: "Histogram."}), MetricTypeHistogram},
+		{prometheus.NewCounter(prometheus.CounterOpts{Name: "counter", Help: "Counter."}), MetricTypeCounter},
+		{prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge", Help: "Gauge."}), MetricTypeGauge},
+		{prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "summary_vec", Help: "Summary."}, []string{"a"}), MetricTypeTimer},
+		{prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "gauge_vec", Help: "Gauge."}, []string{"a"}), MetricTypeGauge},
+	} {
+		if got := collectorMetricType(test.collector); got != test.want {
+			t.Errorf("%T = %s, want %s", test.collector, got, test.want)
+		}
+	}
+}
+
+// TestRegistryCollisionMessage pins the client_golang message register matches: the registry has
+// no typed error for descriptors with the same name but other label names or help.
+func TestRegistryCollisionMessage(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests", Help: "Requests."}, []string{"queue"}))
+
+	err := registry.Register(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests", Help: "Requests."}, []string{"route"}))
+	if err == nil || !strings.Contains(err.Error(), "same fully-qualified name") {
+		t.Fatalf("err = %v, want the client_golang collision message", err)
+	}
+	if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		t.Fatal("want a plain error for a collision with other label names")
+	}
+
+	c, err := NewCollectorWithOptions("pod", "", "", WithRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ObserveCounter("requests", 1, nil)
+	var collision *NameCollisionError
+	if !errors.As(err, &collision) {
+		t.Fatalf("err = %v, want a NameCollisionError", err)
+	}
+	var registration *RegistrationError
+	if errors.As(err, &registration) {
+		t.Errorf("err = %v, want no RegistrationError", err)
+	}
+}
@@ -3,7 +3,11 @@ module github.com/ifrolikov/prometheus_metrics/v4
 go 1.15
 
 require (
+	github.com/golang/snappy v1.0.0
 	github.com/iancoleman/strcase v0.2.0
 	github.com/prometheus/client_golang v1.13.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.37.0
 	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.28.1
 )
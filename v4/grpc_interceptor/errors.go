@@ -0,0 +1,19 @@
+package grpcinterceptor
+
+import "fmt"
+
+// ObservationError wraps a collector error with the gRPC method the observation was made for.
+// The collector error is available to errors.As and errors.Is through Unwrap.
+type ObservationError struct {
+	FullMethod string
+	MetricName string
+	Err        error
+}
+
+func (e *ObservationError) Error() string {
+	return fmt.Sprintf("grpc method %s: metric %s observation failed: %s", e.FullMethod, e.MetricName, e.Err)
+}
+
+func (e *ObservationError) Unwrap() error {
+	return e.Err
+}
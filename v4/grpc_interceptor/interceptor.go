@@ -2,48 +2,50 @@ package grpcinterceptor
 
 import (
 	"context"
-	"github.com/iancoleman/strcase"
 	"github.com/ifrolikov/prometheus_metrics/v4/interfaces"
+	"github.com/ifrolikov/prometheus_metrics/v4/naming"
 	"google.golang.org/grpc"
 	"path"
-	"regexp"
 	"time"
 )
 
-var re = regexp.MustCompile(`[^\w\d]+`)
-
-func NewMetricsTimerUnaryInterceptor(collector interfaces.Collector) grpc.UnaryServerInterceptor {
+func NewMetricsTimerUnaryInterceptor(collector interfaces.Collector, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		startTime := time.Now()
 
 		resp, err := handler(ctx, req)
 
-		method := path.Base(info.FullMethod)
-		metricName := strcase.ToSnake(re.ReplaceAllString(method, "_"))
-
-		hasError := "false"
-		if err != nil {
-			hasError = "true"
-		}
-		_ = collector.ObserveTimer(metricName, startTime, map[string]string{"has_error": hasError})
+		o.handleError(observe(ctx, collector, info.FullMethod, startTime, err))
 		return resp, err
 	}
 }
 
-func NewMetricsTimerStreamInterceptor(collector interfaces.Collector) grpc.StreamServerInterceptor {
+func NewMetricsTimerStreamInterceptor(collector interfaces.Collector, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		startTime := time.Now()
 
 		err := handler(srv, stream)
 
-		method := path.Base(info.FullMethod)
-		metricName := strcase.ToSnake(re.ReplaceAllString(method, "_"))
-
-		hasError := "false"
-		if err != nil {
-			hasError = "true"
-		}
-		_ = collector.ObserveTimer(metricName, startTime, map[string]string{"has_error": hasError})
+		o.handleError(observe(stream.Context(), collector, info.FullMethod, startTime, err))
 		return err
 	}
 }
+
+func observe(ctx context.Context, collector interfaces.Collector, fullMethod string, startTime time.Time, handlerErr error) error {
+	method := path.Base(fullMethod)
+	metricName, err := naming.SanitizeMetricName(method)
+	if err != nil {
+		return &ObservationError{FullMethod: fullMethod, MetricName: method, Err: err}
+	}
+
+	hasError := "false"
+	if handlerErr != nil {
+		hasError = "true"
+	}
+	if err := collector.ObserveTimerCtx(ctx, metricName, startTime, map[string]string{"has_error": hasError}); err != nil {
+		return &ObservationError{FullMethod: fullMethod, MetricName: metricName, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package grpcinterceptor
+
+// Option configures the interceptors.
+type Option func(o *options)
+
+type options struct {
+	errorHandler func(err error)
+}
+
+// WithErrorHandler is called with an *ObservationError when the interceptor fails to observe a call.
+// Collector errors are also reported to the collector's own error handlers.
+func WithErrorHandler(handler func(err error)) Option {
+	return func(o *options) {
+		o.errorHandler = handler
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) handleError(err error) {
+	if err != nil && o.errorHandler != nil {
+		o.errorHandler(err)
+	}
+}
@@ -0,0 +1,283 @@
+package prometheus_metrics
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Handles are bound to a registered metric and, optionally, to a label tuple.
+// They are created through the same registration and validation logic as Observe* calls,
+// but observing through a bound handle takes no collector lock and does not allocate.
+// Label tuples bound to handles never expire by series TTL.
+
+type durationObserver struct {
+	observer    prometheus.Observer
+	nanoseconds bool
+}
+
+type durationHandle struct {
+	observers []durationObserver
+}
+
+func (h *durationHandle) Observe(startTime time.Time) {
+	h.ObserveDuration(time.Since(startTime))
+}
+
+func (h *durationHandle) ObserveDuration(duration time.Duration) {
+	for _, o := range h.observers {
+		if o.nanoseconds {
+			o.observer.Observe(float64(duration))
+		} else {
+			o.observer.Observe(duration.Seconds())
+		}
+	}
+}
+
+type TimerHandle struct {
+	durationHandle
+}
+
+type HistogramHandle struct {
+	durationHandle
+}
+
+type CounterHandle struct {
+	collector *Collector
+	name      string
+	counter   prometheus.Counter
+}
+
+func (h *CounterHandle) Inc() {
+	h.counter.Inc()
+}
+
+func (h *CounterHandle) Add(inc float64) error {
+	if inc < 0 {
+		err := fmt.Errorf("%w: %s by %v", ErrCounterDecrease, h.name, inc)
+		h.collector.handleError(h.name, err)
+		return err
+	}
+	h.counter.Add(inc)
+	return nil
+}
+
+type GaugeHandle struct {
+	prometheus.Gauge
+}
+
+type durationVec struct {
+	metric      *metric
+	nanoseconds bool
+}
+
+type durationVecHandle struct {
+	collector *Collector
+	name      string
+	vecs      []durationVec
+}
+
+func (h *durationVecHandle) with(labels map[string]string) (durationHandle, error) {
+	handle := durationHandle{}
+	for _, v := range h.vecs {
+		seriesLabels, err := h.collector.admitHandleSeries(h.name, v.metric, labels)
+		if err != nil {
+			return durationHandle{}, err
+		}
+		observer, err := v.metric.vec.(prometheus.ObserverVec).GetMetricWith(seriesLabels)
+		if err != nil {
+			return durationHandle{}, err
+		}
+		handle.observers = append(handle.observers, durationObserver{observer: observer, nanoseconds: v.nanoseconds})
+	}
+	return handle, nil
+}
+
+type TimerVecHandle struct {
+	durationVecHandle
+}
+
+func (h *TimerVecHandle) With(labels map[string]string) (*TimerHandle, error) {
+	handle, err := h.with(labels)
+	if err != nil {
+		return nil, err
+	}
+	return &TimerHandle{handle}, nil
+}
+
+type HistogramVecHandle struct {
+	durationVecHandle
+}
+
+func (h *HistogramVecHandle) With(labels map[string]string) (*HistogramHandle, error) {
+	handle, err := h.with(labels)
+	if err != nil {
+		return nil, err
+	}
+	return &HistogramHandle{handle}, nil
+}
+
+type CounterVecHandle struct {
+	collector *Collector
+	name      string
+	metric    *metric
+}
+
+func (h *CounterVecHandle) With(labels map[string]string) (*CounterHandle, error) {
+	seriesLabels, err := h.collector.admitHandleSeries(h.name, h.metric, labels)
+	if err != nil {
+		return nil, err
+	}
+	counter, err := h.metric.vec.(*prometheus.CounterVec).GetMetricWith(seriesLabels)
+	if err != nil {
+		return nil, err
+	}
+	return &CounterHandle{collector: h.collector, name: h.name, counter: counter}, nil
+}
+
+type GaugeVecHandle struct {
+	collector *Collector
+	name      string
+	metric    *metric
+}
+
+func (h *GaugeVecHandle) With(labels map[string]string) (*GaugeHandle, error) {
+	seriesLabels, err := h.collector.admitHandleSeries(h.name, h.metric, labels)
+	if err != nil {
+		return nil, err
+	}
+	gauge, err := h.metric.vec.(*prometheus.GaugeVec).GetMetricWith(seriesLabels)
+	if err != nil {
+		return nil, err
+	}
+	return &GaugeHandle{gauge}, nil
+}
+
+func (c *Collector) admitHandleSeries(name string, m *metric, labels map[string]string) (map[string]string, error) {
+	labels, err := c.sanitizeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkLabels(labels); err != nil {
+		return nil, err
+	}
+	return c.admitSeries(name, m, labels, true)
+}
+
+// TimerVec returns a handle bound to the timer with the given label names.
+func (c *Collector) TimerVec(name string, labelNames []string) (*TimerVecHandle, error) {
+	name = c.sanitizeName(name)
+	labelNames, err := c.sanitizeLabelNames(labelNames)
+	if err != nil {
+		return nil, err
+	}
+	labels := labelNamesMap(labelNames)
+	handle := &TimerVecHandle{durationVecHandle{collector: c, name: name}}
+	for _, metric := range c.durationMetrics(name, true) {
+		m, err := c.timer(name, metric.name, labels)
+		if err != nil {
+			return nil, err
+		}
+		handle.vecs = append(handle.vecs, durationVec{metric: m, nanoseconds: metric.nanoseconds})
+	}
+	return handle, nil
+}
+
+// Timer returns a handle bound to the timer and the label tuple.
+func (c *Collector) Timer(name string, labels map[string]string) (*TimerHandle, error) {
+	vecHandle, err := c.TimerVec(name, labelNamesOf(labels))
+	if err != nil {
+		return nil, err
+	}
+	return vecHandle.With(labels)
+}
+
+// HistogramVec returns a handle bound to the histogram with the given label names.
+func (c *Collector) HistogramVec(name string, labelNames []string) (*HistogramVecHandle, error) {
+	name = c.sanitizeName(name)
+	labelNames, err := c.sanitizeLabelNames(labelNames)
+	if err != nil {
+		return nil, err
+	}
+	labels := labelNamesMap(labelNames)
+	handle := &HistogramVecHandle{durationVecHandle{collector: c, name: name}}
+	for _, metric := range c.durationMetrics(name, false) {
+		m, err := c.histogram(name, metric.name, nil, labels)
+		if err != nil {
+			return nil, err
+		}
+		handle.vecs = append(handle.vecs, durationVec{metric: m, nanoseconds: metric.nanoseconds})
+	}
+	return handle, nil
+}
+
+// Histogram returns a handle bound to the histogram and the label tuple.
+func (c *Collector) Histogram(name string, labels map[string]string) (*HistogramHandle, error) {
+	vecHandle, err := c.HistogramVec(name, labelNamesOf(labels))
+	if err != nil {
+		return nil, err
+	}
+	return vecHandle.With(labels)
+}
+
+// CounterVec returns a handle bound to the counter with the given label names.
+func (c *Collector) CounterVec(name string, labelNames []string) (*CounterVecHandle, error) {
+	name = c.sanitizeName(name)
+	labelNames, err := c.sanitizeLabelNames(labelNames)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.counter(name, labelNamesMap(labelNames))
+	if err != nil {
+		return nil, err
+	}
+	return &CounterVecHandle{collector: c, name: name, metric: m}, nil
+}
+
+// Counter returns a handle bound to the counter and the label tuple.
+func (c *Collector) Counter(name string, labels map[string]string) (*CounterHandle, error) {
+	vecHandle, err := c.CounterVec(name, labelNamesOf(labels))
+	if err != nil {
+		return nil, err
+	}
+	return vecHandle.With(labels)
+}
+
+// GaugeVec returns a handle bound to the gauge with the given label names.
+func (c *Collector) GaugeVec(name string, labelNames []string) (*GaugeVecHandle, error) {
+	name = c.sanitizeName(name)
+	labelNames, err := c.sanitizeLabelNames(labelNames)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.gauge(name, labelNamesMap(labelNames))
+	if err != nil {
+		return nil, err
+	}
+	return &GaugeVecHandle{collector: c, name: name, metric: m}, nil
+}
+
+// Gauge returns a handle bound to the gauge and the label tuple.
+func (c *Collector) Gauge(name string, labels map[string]string) (*GaugeHandle, error) {
+	vecHandle, err := c.GaugeVec(name, labelNamesOf(labels))
+	if err != nil {
+		return nil, err
+	}
+	return vecHandle.With(labels)
+}
+
+func labelNamesMap(labelNames []string) map[string]string {
+	labels := make(map[string]string, len(labelNames))
+	for _, labelName := range labelNames {
+		labels[labelName] = ""
+	}
+	return labels
+}
+
+func labelNamesOf(labels map[string]string) []string {
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	return labelNames
+}
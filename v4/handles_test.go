@@ -0,0 +1,100 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestHandlesDoNotAllocate(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()), WithTimeUnit(TimeUnitSecondsAndLegacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"route": "/users"}
+	counter, err := c.Counter("requests", labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gauge, err := c.Gauge("in_flight", labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timer, err := c.Timer("request", labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	histogram, err := c.Histogram("request_latency", labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, observe := range map[string]func(){
+		"Counter.Inc":               func() { counter.Inc() },
+		"Counter.Add":               func() { _ = counter.Add(2) },
+		"Gauge.Set":                 func() { gauge.Set(3) },
+		"Gauge.Inc":                 func() { gauge.Inc() },
+		"Timer.ObserveDuration":     func() { timer.ObserveDuration(time.Millisecond) },
+		"Histogram.ObserveDuration": func() { histogram.ObserveDuration(time.Millisecond) },
+	} {
+		if allocs := testing.AllocsPerRun(100, observe); allocs != 0 {
+			t.Errorf("%s allocates %v times per observation", name, allocs)
+		}
+	}
+}
+
+func TestVecHandleLabelMismatch(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters, err := c.CounterVec("requests", []string{"route"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := counters.With(map[string]string{"route": "/users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mismatch *LabelMismatchError
+	if _, err := counters.With(map[string]string{"code": "200"}); !errors.As(err, &mismatch) {
+		t.Errorf("err = %v, want a LabelMismatchError", err)
+	}
+	timers, err := c.TimerVec("request", []string{"route"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := timers.With(map[string]string{"route": "/users", "code": "200"}); !errors.As(err, &mismatch) {
+		t.Errorf("err = %v, want a LabelMismatchError", err)
+	}
+}
+
+func TestSeriesTTLSkipsHandleSeries(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry), WithClock(clock), WithSeriesTTL("requests", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.StopJanitor()
+
+	handle, err := c.Counter("requests", map[string]string{"route": "/pinned"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle.Inc()
+	if err := c.ObserveCounter("requests", 1, map[string]string{"route": "/observed"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	c.ExpireStaleSeries()
+
+	if got := routes(t, registry); got != "/pinned" {
+		t.Errorf("routes = %q, want only the handle series left", got)
+	}
+	handle.Inc()
+	if value, _ := seriesValue(t, registry, "ns_sub_requests", map[string]string{"route": "/pinned"}); value != 2 {
+		t.Errorf("pinned series = %v, want 2", value)
+	}
+}
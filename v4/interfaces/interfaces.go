@@ -1,10 +1,34 @@
 package interfaces
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Collector interface {
 	ObserveTimer(name string, startTime time.Time, labels map[string]string) error
 	ObserveHistogram(name string, startTime time.Time, labels map[string]string) error
 	ObserveCounter(name string, inc int, labels map[string]string) error
+	ObserveCounterFloat(name string, inc float64, labels map[string]string) error
 	ObserveGauge(name string, inc int, labels map[string]string) error
-}
\ No newline at end of file
+	SetGauge(name string, value float64, labels map[string]string) error
+	AddGauge(name string, value float64, labels map[string]string) error
+	SubGauge(name string, value float64, labels map[string]string) error
+	IncGauge(name string, labels map[string]string) error
+	DecGauge(name string, labels map[string]string) error
+	SetGaugeToCurrentTime(name string, labels map[string]string) error
+
+	// Ctx variants merge labels attached to the context with ContextWithLabels
+	// into the passed ones where the collector allows it.
+	ObserveTimerCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error
+	ObserveHistogramCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error
+	ObserveCounterCtx(ctx context.Context, name string, inc int, labels map[string]string) error
+	ObserveCounterFloatCtx(ctx context.Context, name string, inc float64, labels map[string]string) error
+	ObserveGaugeCtx(ctx context.Context, name string, inc int, labels map[string]string) error
+	SetGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error
+	AddGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error
+	SubGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error
+	IncGaugeCtx(ctx context.Context, name string, labels map[string]string) error
+	DecGaugeCtx(ctx context.Context, name string, labels map[string]string) error
+	SetGaugeToCurrentTimeCtx(ctx context.Context, name string, labels map[string]string) error
+}
@@ -0,0 +1,60 @@
+package prometheus_metrics
+
+import (
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *Collector) hasSeriesTTL() bool {
+	if c.defaultSeriesTTL > 0 {
+		return true
+	}
+	for _, ttl := range c.seriesTTLMap {
+		if ttl > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Collector) startJanitor() {
+	c.janitorStop = make(chan struct{})
+	c.janitorDone = make(chan struct{})
+
+	go func() {
+		defer close(c.janitorDone)
+
+		ticker := time.NewTicker(c.janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.ExpireStaleSeries()
+			case <-c.janitorStop:
+				return
+			}
+		}
+	}()
+}
+
+// StopJanitor stops the background expiry of stale series and waits for it to finish.
+func (c *Collector) StopJanitor() {
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if c.janitorStop == nil {
+		return
+	}
+	close(c.janitorStop)
+	<-c.janitorDone
+	c.janitorStop = nil
+}
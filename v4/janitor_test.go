@@ -0,0 +1,113 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is read by the janitor goroutine while the test advances it.
+type fakeClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	defer f.mtx.Unlock()
+	f.mtx.Lock()
+
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	defer f.mtx.Unlock()
+	f.mtx.Lock()
+
+	f.now = f.now.Add(d)
+}
+
+func TestJanitorExpiresSeriesByInjectedClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithClock(clock),
+		WithSeriesTTL("requests", time.Minute),
+		WithJanitorInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	stale := map[string]string{"route": "/stale"}
+	fresh := map[string]string{"route": "/fresh"}
+	for _, labels := range []map[string]string{stale, fresh} {
+		if err := c.ObserveCounter("requests", 1, labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(40 * time.Second)
+	if err := c.ObserveCounter("requests", 1, fresh); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(40 * time.Second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for routes(t, registry) != "/fresh" {
+		if time.Now().After(deadline) {
+			t.Fatalf("routes = %q, want only /fresh left after the janitor runs", routes(t, registry))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExpireStaleSeriesKeepsSeriesWithinTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry), WithClock(clock), WithSeriesTTL("requests", time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.StopJanitor()
+
+	if err := c.ObserveCounter("requests", 1, map[string]string{"route": "/"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	c.ExpireStaleSeries()
+	if got := routes(t, registry); got != "/" {
+		t.Fatalf("routes = %q, a series exactly at the TTL must be kept", got)
+	}
+	clock.Advance(time.Nanosecond)
+	c.ExpireStaleSeries()
+	if got := routes(t, registry); got != "" {
+		t.Fatalf("routes = %q, want the series expired", got)
+	}
+}
+
+// routes returns the route labels of ns_sub_requests joined with commas.
+func routes(t *testing.T, gatherer prometheus.Gatherer) string {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := ""
+	for _, mf := range mfs {
+		if mf.GetName() != "ns_sub_requests" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if label.GetName() != "route" {
+					continue
+				}
+				if result != "" {
+					result += ","
+				}
+				result += label.GetValue()
+			}
+		}
+	}
+	return result
+}
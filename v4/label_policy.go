@@ -0,0 +1,141 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+)
+
+type LabelMismatchPolicy int
+
+const (
+	// LabelMismatchReject returns an error and loses the observation.
+	LabelMismatchReject LabelMismatchPolicy = iota
+	// LabelMismatchFill fills missing labels with the value set by WithMissingLabelValue and drops unknown ones.
+	LabelMismatchFill
+	// LabelMismatchSeparateMetric observes a separate metric whose name is suffixed with the requested label names.
+	LabelMismatchSeparateMetric
+)
+
+func (p LabelMismatchPolicy) String() string {
+	switch p {
+	case LabelMismatchReject:
+		return "reject"
+	case LabelMismatchFill:
+		return "fill"
+	case LabelMismatchSeparateMetric:
+		return "separate_metric"
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// observeWithLabelPolicy runs the observation and, if its labels do not match the metric,
+// retries it according to the collector label mismatch policy.
+func (c *Collector) observeWithLabelPolicy(name string, labels map[string]string, observe func(name string, labels map[string]string) error) error {
+	name = c.sanitizeName(name)
+	labels, err := c.sanitizeLabels(labels)
+	if err != nil {
+		return err
+	}
+	err = observe(name, labels)
+	if err == nil {
+		return nil
+	}
+	var mismatch *LabelMismatchError
+	if !errors.As(err, &mismatch) {
+		return err
+	}
+
+	switch c.labelMismatchPolicy {
+	case LabelMismatchFill:
+		filledLabels := make(map[string]string, len(mismatch.ExpectedLabelNames))
+		for _, labelName := range mismatch.ExpectedLabelNames {
+			if value, ok := labels[labelName]; ok {
+				filledLabels[labelName] = value
+			} else {
+				filledLabels[labelName] = c.missingLabelValue
+				c.reportLabelMismatch(name, "filled", labelName)
+			}
+		}
+		for labelName := range labels {
+			if _, ok := filledLabels[labelName]; !ok {
+				c.reportLabelMismatch(name, "dropped", labelName)
+			}
+		}
+		return observe(name, filledLabels)
+	case LabelMismatchSeparateMetric:
+		c.reportLabelMismatch(name, "separated", "")
+		separatedName := separatedMetricName(name, mismatch.GotLabelNames)
+		c.rememberSeparatedMetric(name, separatedName)
+		return observe(separatedName, labels)
+	}
+	c.reportLabelMismatch(name, "rejected", "")
+	return err
+}
+
+func separatedMetricName(name string, labelNames []string) string {
+	if len(labelNames) == 0 {
+		return name + "_no_labels"
+	}
+	return name + "_by_" + strings.Join(labelNames, "_")
+}
+
+// rememberSeparatedMetric records the metric separated from the named one,
+// so Unregister, Reset and DeleteSeries of the name reach it too.
+func (c *Collector) rememberSeparatedMetric(name string, separatedName string) {
+	if _, ok := c.separatedMetrics.load(separatedName); ok {
+		return
+	}
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	c.separatedMetrics.store(separatedName, name)
+}
+
+// reportLabelMismatch counts label mismatches in a self-monitoring metric registered on the first mismatch.
+func (c *Collector) reportLabelMismatch(name string, action string, labelName string) {
+	counter := c.selfCounter(&c.labelMismatchCounter, "label_mismatches_total",
+		"Observations whose labels did not match the metric labels.", []string{"metric", "policy", "action", "label"})
+	if counter != nil {
+		counter.WithLabelValues(name, c.labelMismatchPolicy.String(), action, labelName).Inc()
+	}
+}
+
+// selfCounter lazily registers a counter the collector reports its own problems to.
+// Once registered it is loaded without the collector lock, as observe paths report to it.
+// It lives under the self metrics namespace if one is configured and under the service one otherwise.
+// It returns nil if the counter cannot be registered.
+func (c *Collector) selfCounter(counter *counterVecValue, name string, help string, labelNames []string) *prometheus.CounterVec {
+	if vec := counter.load(); vec != nil {
+		return vec
+	}
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if vec := counter.load(); vec != nil {
+		return vec
+	}
+	namespace, subsystem := c.namespace, c.subsystem
+	if c.selfMetricsNamespace != "" {
+		namespace, subsystem = c.selfMetricsNamespace, ""
+	}
+	vec := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: c.constLabels,
+		}, labelNames)
+	if err := c.registerer.Register(vec); err != nil {
+		alreadyRegistered, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil
+		}
+		vec, _ = alreadyRegistered.ExistingCollector.(*prometheus.CounterVec)
+	}
+	counter.store(vec)
+	return vec
+}
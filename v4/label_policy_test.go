@@ -0,0 +1,144 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+// seriesValue returns the value of the counter or gauge series having all the labels.
+func seriesValue(t *testing.T, gatherer prometheus.Gatherer, name string, labels map[string]string) (float64, bool) {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.Metric {
+			matched := 0
+			for _, label := range m.Label {
+				if value, ok := labels[label.GetName()]; ok && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				return m.GetCounter().GetValue() + m.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestLabelMismatchFill(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithLabelMismatchPolicy(LabelMismatchFill),
+		WithMissingLabelValue("none"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, map[string]string{"route": "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 4, map[string]string{"route": "/a", "user": "u1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for route, want := range map[string]float64{"/a": 5, "none": 2} {
+		if value, _ := seriesValue(t, registry, "ns_sub_requests", map[string]string{"route": route}); value != want {
+			t.Errorf("requests{route=%q} = %v, want %v", route, value, want)
+		}
+	}
+	for _, labels := range []map[string]string{
+		{"metric": "requests", "policy": "fill", "action": "filled", "label": "route"},
+		{"metric": "requests", "policy": "fill", "action": "dropped", "label": "user"},
+	} {
+		if value, _ := seriesValue(t, registry, "ns_sub_label_mismatches_total", labels); value != 1 {
+			t.Errorf("label_mismatches_total%v = %v, want 1", labels, value)
+		}
+	}
+}
+
+func TestLabelMismatchSeparateMetric(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithLabelMismatchPolicy(LabelMismatchSeparateMetric))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, map[string]string{"route": "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 2, map[string]string{"code": "200", "route": "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 3, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]float64{
+		"ns_sub_requests":               1,
+		"ns_sub_requests_by_code_route": 2,
+		"ns_sub_requests_no_labels":     3,
+	} {
+		if value, ok := seriesValue(t, registry, name, nil); !ok || value != want {
+			t.Errorf("%s = %v, want %v", name, value, want)
+		}
+	}
+	labels := map[string]string{"metric": "requests", "policy": "separate_metric", "action": "separated"}
+	if value, _ := seriesValue(t, registry, "ns_sub_label_mismatches_total", labels); value != 2 {
+		t.Errorf("separated observations = %v, want 2", value)
+	}
+
+	if err := c.Reset("requests"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ns_sub_requests", "ns_sub_requests_by_code_route", "ns_sub_requests_no_labels"} {
+		if _, ok := seriesValue(t, registry, name, nil); ok {
+			t.Errorf("%s has series after Reset", name)
+		}
+	}
+	if err := c.ObserveCounter("requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Unregister("requests"); err != nil {
+		t.Fatal(err)
+	}
+	names := gatheredNames(t, registry)
+	for _, name := range []string{"ns_sub_requests", "ns_sub_requests_by_code_route", "ns_sub_requests_no_labels"} {
+		if names[name] {
+			t.Errorf("%s is registered after Unregister", name)
+		}
+	}
+}
+
+func TestLabelMismatchReject(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, map[string]string{"route": "/a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.ObserveCounter("requests", 1, map[string]string{"code": "200"})
+	var mismatch *LabelMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("err = %v, want a LabelMismatchError", err)
+	}
+	if value, _ := seriesValue(t, registry, "ns_sub_requests", nil); value != 1 {
+		t.Errorf("requests = %v, want the rejected observation lost", value)
+	}
+	labels := map[string]string{"metric": "requests", "policy": "reject", "action": "rejected"}
+	if value, _ := seriesValue(t, registry, "ns_sub_label_mismatches_total", labels); value != 1 {
+		t.Errorf("rejected observations = %v, want 1", value)
+	}
+}
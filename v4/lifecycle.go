@@ -0,0 +1,223 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const defaultCloseTimeout = 30 * time.Second
+
+type ownedMetric struct {
+	metrics    *readMostlyMap
+	metricName string
+	metric     *metric
+}
+
+// ownedMetrics returns the registered series families observed under the name and the ones
+// separated from it by LabelMismatchSeparateMetric, of the metric type or of any type if it is empty.
+func (c *Collector) ownedMetrics(name string, metricType MetricType) []ownedMetric {
+	owned := c.ownedMetricsNamed(name, metricType)
+	for separatedName, baseName := range c.separatedMetrics.snapshot() {
+		if baseName.(string) == name {
+			owned = append(owned, c.ownedMetricsNamed(separatedName, metricType)...)
+		}
+	}
+	return owned
+}
+
+func (c *Collector) ownedMetricsNamed(name string, metricType MetricType) []ownedMetric {
+	var owned []ownedMetric
+	find := func(findType MetricType, metrics *readMostlyMap, metricName string) {
+		if metricType != "" && metricType != findType {
+			return
+		}
+		if item, ok := metrics.load(metricName); ok {
+			owned = append(owned, ownedMetric{metrics: metrics, metricName: metricName, metric: item.(*metric)})
+		}
+	}
+	for _, metricName := range []string{name, secondsMetricName(name)} {
+		find(MetricTypeTimer, &c.timeMetrics, metricName)
+		find(MetricTypeHistogram, &c.histogramMetrics, metricName)
+	}
+	find(MetricTypeCounter, &c.counterMetrics, c.unitMetricName(name))
+	find(MetricTypeGauge, &c.gaugeMetrics, c.unitMetricName(name))
+	return owned
+}
+
+// Unregister removes the metric from the registry. The next observation registers it again,
+// handles created before keep observing the unregistered metric.
+// Metrics of every type observed under the name are removed, e.g. both the counter and the timer
+// observed as "requests"; UnregisterOfType removes only one of them. Metrics separated from it by
+// LabelMismatchSeparateMetric are removed as well.
+func (c *Collector) Unregister(name string) error {
+	return c.unregister(name, "")
+}
+
+// UnregisterOfType is Unregister limited to the metric of the type.
+func (c *Collector) UnregisterOfType(name string, metricType MetricType) error {
+	return c.unregister(name, metricType)
+}
+
+func (c *Collector) unregister(name string, metricType MetricType) error {
+	name = c.sanitizeName(name)
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	owned := c.ownedMetrics(name, metricType)
+	if len(owned) == 0 {
+		return fmt.Errorf("%w: %s", ErrNotRegistered, name)
+	}
+	for _, o := range owned {
+		c.registerer.Unregister(o.metric.vec)
+		o.metrics.delete(o.metricName)
+		delete(c.registeredNames, o.metric.name)
+		c.forgetSeries(o.metric)
+	}
+	return nil
+}
+
+// Reset deletes all the series of the metric keeping it registered.
+// Like Unregister, it resets metrics of every type observed under the name and the separated ones.
+func (c *Collector) Reset(name string) error {
+	return c.reset(name, "")
+}
+
+// ResetOfType is Reset limited to the metric of the type.
+func (c *Collector) ResetOfType(name string, metricType MetricType) error {
+	return c.reset(name, metricType)
+}
+
+func (c *Collector) reset(name string, metricType MetricType) error {
+	name = c.sanitizeName(name)
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	owned := c.ownedMetrics(name, metricType)
+	if len(owned) == 0 {
+		return fmt.Errorf("%w: %s", ErrNotRegistered, name)
+	}
+	for _, o := range owned {
+		o.metric.vec.(interface{ Reset() }).Reset()
+		c.forgetSeries(o.metric)
+	}
+	return nil
+}
+
+// DeleteSeries deletes a single label tuple of the metric. Of the metrics of different types
+// observed under the name, only the ones with the label names of the tuple are affected;
+// a LabelMismatchError is returned if there are none.
+func (c *Collector) DeleteSeries(name string, labels map[string]string) error {
+	return c.deleteSeries(name, "", labels)
+}
+
+// DeleteSeriesOfType is DeleteSeries limited to the metric of the type.
+func (c *Collector) DeleteSeriesOfType(name string, metricType MetricType, labels map[string]string) error {
+	return c.deleteSeries(name, metricType, labels)
+}
+
+func (c *Collector) deleteSeries(name string, metricType MetricType, labels map[string]string) error {
+	name = c.sanitizeName(name)
+	labels, err := c.sanitizeLabels(labels)
+	if err != nil {
+		return err
+	}
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	owned := c.ownedMetrics(name, metricType)
+	if len(owned) == 0 {
+		return fmt.Errorf("%w: %s", ErrNotRegistered, name)
+	}
+	var mismatch error
+	matched := owned[:0]
+	for _, o := range owned {
+		if err := o.metric.checkLabels(labels); err != nil {
+			mismatch = err
+			continue
+		}
+		matched = append(matched, o)
+	}
+	if len(matched) == 0 {
+		return mismatch
+	}
+	for _, o := range matched {
+		o.metric.vec.(interface {
+			Delete(labels prometheus.Labels) bool
+		}).Delete(labels)
+		if o.metric.series != nil {
+			hash := hashLabelValues(o.metric.labelNames, labels)
+			o.metric.series.mtx.Lock()
+			if s := o.metric.series.find(hash, o.metric.labelNames, labels); s != nil {
+				o.metric.series.remove(hash, s)
+				c.releaseSeries(1)
+			}
+			o.metric.series.mtx.Unlock()
+		}
+	}
+	return nil
+}
+
+// Close is CloseContext with a 30s deadline.
+func (c *Collector) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+
+	return c.CloseContext(ctx)
+}
+
+// CloseContext stops the janitor, pushes the final state of the metrics if the Pushgateway or remote write
+// is configured and unregisters every metric the collector owns, its own metrics included.
+// The final push is abandoned when ctx is done; the metrics are unregistered even if it fails.
+// Samples the remote write did not send by then are dropped and counted.
+func (c *Collector) CloseContext(ctx context.Context) error {
+	c.StopJanitor()
+	var remoteWriteErr error
+	if c.remoteWriter != nil {
+		remoteWriteErr = c.remoteWriter.shutdown(ctx)
+		c.remoteWriter = nil
+	}
+	err := c.stopPusher(ctx)
+	if err == nil {
+		err = remoteWriteErr
+	}
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	for _, metrics := range []*readMostlyMap{&c.timeMetrics, &c.histogramMetrics, &c.counterMetrics, &c.gaugeMetrics} {
+		for metricName, item := range metrics.snapshot() {
+			c.registerer.Unregister(item.(*metric).vec)
+			metrics.delete(metricName)
+			delete(c.registeredNames, item.(*metric).name)
+			c.forgetSeries(item.(*metric))
+		}
+	}
+	for _, counter := range []*counterVecValue{&c.labelMismatchCounter, &c.cardinalityOverflows, &c.errorCounter, &c.remoteWriteSent, &c.remoteWriteDropped} {
+		if vec := counter.load(); vec != nil {
+			c.registerer.Unregister(vec)
+			counter.store(nil)
+		}
+	}
+	if c.selfMetrics != nil {
+		c.registerer.Unregister(c.selfMetrics)
+	}
+	if c.buildInfo != nil {
+		c.registerer.Unregister(c.buildInfo)
+		delete(c.registeredNames, buildInfoMetricName)
+		c.buildInfo = nil
+	}
+	return err
+}
+
+func (c *Collector) forgetSeries(m *metric) {
+	if m.series == nil {
+		return
+	}
+	m.series.mtx.Lock()
+	c.releaseSeries(m.series.count)
+	m.series.series = make(map[uint64][]*series)
+	m.series.count = 0
+	m.series.mtx.Unlock()
+}
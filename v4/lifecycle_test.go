@@ -0,0 +1,101 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func newLifecycleCollector(t *testing.T) (*Collector, *prometheus.Registry) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("foo", 1, map[string]string{"code": "200"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveTimer("foo", time.Now(), map[string]string{"route": "/"}); err != nil {
+		t.Fatal(err)
+	}
+	return c, registry
+}
+
+func gatheredNames(t *testing.T, gatherer prometheus.Gatherer) map[string]bool {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool, len(mfs))
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+	return names
+}
+
+func TestUnregisterRemovesEveryTypeOfTheName(t *testing.T) {
+	c, registry := newLifecycleCollector(t)
+	if err := c.Unregister("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if names := gatheredNames(t, registry); names["ns_sub_foo"] || names["ns_sub_foo_seconds"] {
+		t.Errorf("gathered %v, want both the counter and the timer unregistered", names)
+	}
+}
+
+func TestUnregisterOfTypeKeepsOtherTypes(t *testing.T) {
+	c, registry := newLifecycleCollector(t)
+	if err := c.UnregisterOfType("foo", MetricTypeCounter); err != nil {
+		t.Fatal(err)
+	}
+	names := gatheredNames(t, registry)
+	if names["ns_sub_foo"] || !names["ns_sub_foo_seconds"] {
+		t.Errorf("gathered %v, want only the counter unregistered", names)
+	}
+	if err := c.UnregisterOfType("foo", MetricTypeGauge); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("unregistering a type never observed: %v, want ErrNotRegistered", err)
+	}
+}
+
+func TestDeleteSeriesSkipsTypesWithOtherLabels(t *testing.T) {
+	c, registry := newLifecycleCollector(t)
+	if err := c.DeleteSeries("foo", map[string]string{"code": "200"}); err != nil {
+		t.Fatalf("deleting the counter series: %v", err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "ns_sub_foo_seconds" && len(mf.Metric) != 1 {
+			t.Errorf("timer series = %d, want the timer untouched", len(mf.Metric))
+		}
+	}
+	var mismatch *LabelMismatchError
+	if err := c.DeleteSeries("foo", map[string]string{"other": "x"}); !errors.As(err, &mismatch) {
+		t.Errorf("deleting labels no metric has: %v, want LabelMismatchError", err)
+	}
+	if err := c.DeleteSeriesOfType("foo", MetricTypeTimer, map[string]string{"code": "200"}); !errors.As(err, &mismatch) {
+		t.Errorf("deleting counter labels from the timer: %v, want LabelMismatchError", err)
+	}
+}
+
+func TestResetOfType(t *testing.T) {
+	c, registry := newLifecycleCollector(t)
+	if err := c.ResetOfType("foo", MetricTypeTimer); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "ns_sub_foo" && len(mf.Metric) != 1 {
+			t.Errorf("counter series = %d, want the counter untouched", len(mf.Metric))
+		}
+		if mf.GetName() == "ns_sub_foo_seconds" {
+			t.Errorf("timer series = %d, want the timer reset", len(mf.Metric))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"sync/atomic"
+)
+
+// readMostlyMap is a copy-on-write map: reads are lock-free and allocation-free,
+// writes copy the whole map and must be serialised by the caller (Collector.mtx).
+type readMostlyMap struct {
+	value atomic.Value
+}
+
+func (m *readMostlyMap) snapshot() map[string]interface{} {
+	items, _ := m.value.Load().(map[string]interface{})
+	return items
+}
+
+func (m *readMostlyMap) load(key string) (interface{}, bool) {
+	item, ok := m.snapshot()[key]
+	return item, ok
+}
+
+func (m *readMostlyMap) store(key string, item interface{}) {
+	current := m.snapshot()
+	items := make(map[string]interface{}, len(current)+1)
+	for k, v := range current {
+		items[k] = v
+	}
+	items[key] = item
+	m.value.Store(items)
+}
+
+func (m *readMostlyMap) delete(key string) {
+	current := m.snapshot()
+	items := make(map[string]interface{}, len(current))
+	for k, v := range current {
+		if k != key {
+			items[k] = v
+		}
+	}
+	m.value.Store(items)
+}
+
+type metric struct {
+	name       string
+	vec        prometheus.Collector
+	labelNames []string
+	buckets    []float64
+	series     *seriesSet
+}
+
+func (m *metric) checkLabels(labels map[string]string) error {
+	if len(labels) == len(m.labelNames) {
+		matched := true
+		for _, labelName := range m.labelNames {
+			if _, ok := labels[labelName]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return nil
+		}
+	}
+
+	return &LabelMismatchError{
+		Name:               m.name,
+		ExpectedLabelNames: m.labelNames,
+		GotLabelNames:      sortedLabelNames(labels),
+	}
+}
+
+// lookupMetric returns nil without an error if the metric is not registered yet.
+func lookupMetric(metrics *readMostlyMap, metricName string, labels map[string]string) (*metric, error) {
+	item, ok := metrics.load(metricName)
+	if !ok {
+		return nil, nil
+	}
+	m := item.(*metric)
+	if err := m.checkLabels(labels); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func sortedLabelNames(labels map[string]string) []string {
+	var labelNames []string
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	return labelNames
+}
+
+// counterVecValue holds a lazily registered self counter: loads are lock-free,
+// stores must be serialised by the caller (Collector.mtx).
+type counterVecValue struct {
+	value atomic.Value
+}
+
+func (v *counterVecValue) load() *prometheus.CounterVec {
+	vec, _ := v.value.Load().(*prometheus.CounterVec)
+	return vec
+}
+
+func (v *counterVecValue) store(vec *prometheus.CounterVec) {
+	v.value.Store(vec)
+}
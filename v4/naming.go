@@ -0,0 +1,85 @@
+package prometheus_metrics
+
+import (
+	"fmt"
+	"github.com/ifrolikov/prometheus_metrics/v4/naming"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InvalidNameError is returned for metric and label names that cannot be used.
+type InvalidNameError = naming.InvalidNameError
+
+// validateNames checks the fully-qualified metric name and the label names before registration,
+// so invalid names are reported as errors rather than by the registry.
+func (c *Collector) validateNames(metricName string, labelNames []string) error {
+	if err := naming.ValidateMetricName(prometheus.BuildFQName(c.namespace, c.subsystem, metricName)); err != nil {
+		return err
+	}
+	for _, labelName := range labelNames {
+		if err := naming.ValidateLabelName(labelName); err != nil {
+			return err
+		}
+		if _, ok := c.constLabels[labelName]; ok {
+			return &InvalidNameError{Name: labelName, Label: true, Reason: "is a const label of the collector"}
+		}
+	}
+	return nil
+}
+
+// sanitizeName returns the name as is unless the collector sanitises names.
+// Sanitised names are cached, so observing a known name does not allocate.
+func (c *Collector) sanitizeName(name string) string {
+	if !c.sanitizeNames {
+		return name
+	}
+	if sanitized, ok := c.sanitizedNames.load(name); ok {
+		return sanitized.(string)
+	}
+	sanitized := naming.Sanitize(name)
+	c.mtx.Lock()
+	c.sanitizedNames.store(name, sanitized)
+	c.mtx.Unlock()
+	return sanitized
+}
+
+// sanitizeLabels returns the labels as is if all the label names are already sanitised.
+// Label names sanitised to the same name, e.g. userId and user_id, are rejected instead of losing a value.
+func (c *Collector) sanitizeLabels(labels map[string]string) (map[string]string, error) {
+	if !c.sanitizeNames {
+		return labels, nil
+	}
+	for labelName := range labels {
+		if c.sanitizeName(labelName) != labelName {
+			sanitized := make(map[string]string, len(labels))
+			for labelName, value := range labels {
+				sanitizedName := c.sanitizeName(labelName)
+				if _, ok := sanitized[sanitizedName]; ok {
+					return nil, sanitizedLabelCollision(labelName, sanitizedName)
+				}
+				sanitized[sanitizedName] = value
+			}
+			return sanitized, nil
+		}
+	}
+	return labels, nil
+}
+
+func (c *Collector) sanitizeLabelNames(labelNames []string) ([]string, error) {
+	if !c.sanitizeNames {
+		return labelNames, nil
+	}
+	sanitized := make([]string, len(labelNames))
+	seen := make(map[string]bool, len(labelNames))
+	for i, labelName := range labelNames {
+		sanitized[i] = c.sanitizeName(labelName)
+		if seen[sanitized[i]] {
+			return nil, sanitizedLabelCollision(labelName, sanitized[i])
+		}
+		seen[sanitized[i]] = true
+	}
+	return sanitized, nil
+}
+
+func sanitizedLabelCollision(labelName string, sanitizedName string) error {
+	return &InvalidNameError{Name: labelName, Label: true, Reason: fmt.Sprintf("is sanitised to %s like another label", sanitizedName)}
+}
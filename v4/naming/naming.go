@@ -0,0 +1,101 @@
+// Package naming validates and sanitises metric and label names against the Prometheus data model.
+package naming
+
+import (
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"regexp"
+	"strings"
+)
+
+// ReservedPrefix starts names reserved for Prometheus internal use.
+const ReservedPrefix = "__"
+
+var (
+	metricNameRe   = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	invalidCharsRe = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+)
+
+// reservedLabelNames are set by the client library itself for histograms and summaries.
+var reservedLabelNames = map[string]string{
+	"le":       "is reserved for histogram buckets",
+	"quantile": "is reserved for summary quantiles",
+}
+
+// InvalidNameError is returned for metric and label names that cannot be used.
+type InvalidNameError struct {
+	Name string
+	// Label reports that Name is a label name.
+	Label  bool
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	kind := "metric"
+	if e.Label {
+		kind = "label"
+	}
+	return fmt.Sprintf("invalid %s name %q: %s", kind, e.Name, e.Reason)
+}
+
+// ValidateMetricName checks the name against the Prometheus data model.
+func ValidateMetricName(name string) error {
+	if name == "" {
+		return &InvalidNameError{Name: name, Reason: "must not be empty"}
+	}
+	if strings.HasPrefix(name, ReservedPrefix) {
+		return &InvalidNameError{Name: name, Reason: fmt.Sprintf("prefix %s is reserved", ReservedPrefix)}
+	}
+	if !metricNameRe.MatchString(name) {
+		return &InvalidNameError{Name: name, Reason: "must match " + metricNameRe.String()}
+	}
+	return nil
+}
+
+// ValidateLabelName checks the label name against the Prometheus data model.
+// Label names set by histograms and summaries are rejected as well.
+func ValidateLabelName(name string) error {
+	if name == "" {
+		return &InvalidNameError{Name: name, Label: true, Reason: "must not be empty"}
+	}
+	if strings.HasPrefix(name, ReservedPrefix) {
+		return &InvalidNameError{Name: name, Label: true, Reason: fmt.Sprintf("prefix %s is reserved", ReservedPrefix)}
+	}
+	if reason, ok := reservedLabelNames[name]; ok {
+		return &InvalidNameError{Name: name, Label: true, Reason: reason}
+	}
+	if !labelNameRe.MatchString(name) {
+		return &InvalidNameError{Name: name, Label: true, Reason: "must match " + labelNameRe.String()}
+	}
+	return nil
+}
+
+// Sanitize converts the name to snake_case replacing invalid characters with underscores,
+// e.g. "GetUser.v2" becomes "get_user_v_2". The result still has to be validated:
+// reserved names are not rewritten.
+func Sanitize(name string) string {
+	sanitized := strcase.ToSnake(invalidCharsRe.ReplaceAllString(name, "_"))
+	if sanitized != "" && sanitized[0] >= '0' && sanitized[0] <= '9' {
+		sanitized = "_" + sanitized
+	}
+	return sanitized
+}
+
+// SanitizeMetricName sanitises the name and validates the result.
+func SanitizeMetricName(name string) (string, error) {
+	sanitized := Sanitize(name)
+	if err := ValidateMetricName(sanitized); err != nil {
+		return "", err
+	}
+	return sanitized, nil
+}
+
+// SanitizeLabelName sanitises the label name and validates the result.
+func SanitizeLabelName(name string) (string, error) {
+	sanitized := Sanitize(name)
+	if err := ValidateLabelName(sanitized); err != nil {
+		return "", err
+	}
+	return sanitized, nil
+}
@@ -0,0 +1,80 @@
+package naming
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateMetricName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"http_requests_total": true,
+		"job:requests:rate5m": true,
+		"_private":            true,
+		"":                    false,
+		"__internal":          false,
+		"2xx_responses":       false,
+		"requests-total":      false,
+		"requests.total":      false,
+	} {
+		err := ValidateMetricName(name)
+		if valid != (err == nil) {
+			t.Errorf("ValidateMetricName(%q) = %v, want valid %v", name, err, valid)
+		}
+		var invalid *InvalidNameError
+		if err != nil && (!errors.As(err, &invalid) || invalid.Label) {
+			t.Errorf("ValidateMetricName(%q) = %#v, want a metric InvalidNameError", name, err)
+		}
+	}
+}
+
+func TestValidateLabelName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"route":    true,
+		"_shard":   true,
+		"":         false,
+		"__name__": false,
+		"le":       false,
+		"quantile": false,
+		"1st":      false,
+		"job:name": false,
+	} {
+		err := ValidateLabelName(name)
+		if valid != (err == nil) {
+			t.Errorf("ValidateLabelName(%q) = %v, want valid %v", name, err, valid)
+		}
+		var invalid *InvalidNameError
+		if err != nil && (!errors.As(err, &invalid) || !invalid.Label) {
+			t.Errorf("ValidateLabelName(%q) = %#v, want a label InvalidNameError", name, err)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for name, want := range map[string]string{
+		"GetUser.v2":     "get_user_v_2",
+		"GetUser":        "get_user",
+		"already_snake":  "already_snake",
+		"http-requests":  "http_requests",
+		"2xx":            "_2_xx",
+		"cache hit/miss": "cache_hit_miss",
+		"":               "",
+	} {
+		if got := Sanitize(name); got != want {
+			t.Errorf("Sanitize(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSanitizeKeepsReservedNamesInvalid(t *testing.T) {
+	if _, err := SanitizeMetricName("__name__"); err == nil {
+		t.Error("want the reserved metric name rejected")
+	}
+	for _, name := range []string{"le", "quantile", "__meta"} {
+		if _, err := SanitizeLabelName(name); err == nil {
+			t.Errorf("SanitizeLabelName(%q): want an error", name)
+		}
+	}
+	if got, err := SanitizeLabelName("userId"); err != nil || got != "user_id" {
+		t.Errorf("SanitizeLabelName(userId) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,30 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestSanitizedLabelNamesMustNotCollide(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry), WithNameSanitization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("GetUser", 1, map[string]string{"userId": "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := seriesValue(t, registry, "ns_sub_get_user", map[string]string{"user_id": "u1"}); !ok || value != 1 {
+		t.Errorf("get_user{user_id=u1} = %v, want the sanitised names", value)
+	}
+
+	var invalid *InvalidNameError
+	err = c.ObserveCounter("GetUser", 1, map[string]string{"userId": "u1", "user_id": "u2"})
+	if !errors.As(err, &invalid) || !invalid.Label {
+		t.Errorf("err = %v, want a label InvalidNameError", err)
+	}
+	if _, err := c.CounterVec("GetOrder", []string{"orderId", "order_id"}); !errors.As(err, &invalid) {
+		t.Errorf("err = %v, want an InvalidNameError for the vec label names", err)
+	}
+}
@@ -0,0 +1,197 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+type Option func(c *Collector) error
+
+// WithRegistry makes the collector register its metrics in the given registry
+// instead of the global default one.
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(c *Collector) error {
+		if registry == nil {
+			return errors.New("registry must not be nil")
+		}
+		c.registerer = registry
+		c.gatherer = registry
+		return nil
+	}
+}
+
+// WithRegistererGatherer is like WithRegistry for the cases when registration and
+// gathering are done through different objects (e.g. a prometheus.WrapRegistererWith wrapper).
+func WithRegistererGatherer(registerer prometheus.Registerer, gatherer prometheus.Gatherer) Option {
+	return func(c *Collector) error {
+		if registerer == nil || gatherer == nil {
+			return errors.New("registerer and gatherer must not be nil")
+		}
+		c.registerer = registerer
+		c.gatherer = gatherer
+		return nil
+	}
+}
+
+// WithDefaultHistogramBuckets replaces the bucket layout used for histograms without declared buckets.
+func WithDefaultHistogramBuckets(buckets []float64) Option {
+	return func(c *Collector) error {
+		if err := validateBuckets(buckets); err != nil {
+			return err
+		}
+		c.defaultHistogramBuckets = append([]float64(nil), buckets...)
+		return nil
+	}
+}
+
+// WithHistogramBuckets declares the bucket layout of a single histogram.
+func WithHistogramBuckets(name string, buckets []float64) Option {
+	return func(c *Collector) error {
+		return c.declareHistogramBuckets(name, buckets)
+	}
+}
+
+// WithDefaultSummaryConfig replaces the summary config used for timers without a declared config.
+// Zero fields keep the library defaults.
+func WithDefaultSummaryConfig(config SummaryConfig) Option {
+	return func(c *Collector) error {
+		if err := validateSummaryConfig(config); err != nil {
+			return err
+		}
+		c.defaultSummaryConfig = config.withDefaults(c.defaultSummaryConfig).copy()
+		return nil
+	}
+}
+
+// WithSummaryConfig declares the summary config of a single timer.
+func WithSummaryConfig(name string, config SummaryConfig) Option {
+	return func(c *Collector) error {
+		return c.declareSummaryConfig(name, config)
+	}
+}
+
+// WithTimeUnit chooses how timers and histograms record durations, TimeUnitSeconds by default.
+func WithTimeUnit(unit TimeUnit) Option {
+	return func(c *Collector) error {
+		switch unit {
+		case TimeUnitSeconds, TimeUnitLegacyNanoseconds, TimeUnitSecondsAndLegacy:
+			c.timeUnit = unit
+			return nil
+		}
+		return errors.New(fmt.Sprintf("unknown time unit: %d", unit))
+	}
+}
+
+// WithStrictDefinitions rejects observations of metrics that were not defined with Define* methods.
+func WithStrictDefinitions() Option {
+	return func(c *Collector) error {
+		c.strictDefinitions = true
+		return nil
+	}
+}
+
+// WithLabelMismatchPolicy chooses what happens with observations whose label names differ from the metric ones.
+func WithLabelMismatchPolicy(policy LabelMismatchPolicy) Option {
+	return func(c *Collector) error {
+		switch policy {
+		case LabelMismatchReject, LabelMismatchFill, LabelMismatchSeparateMetric:
+			c.labelMismatchPolicy = policy
+			return nil
+		}
+		return errors.New(fmt.Sprintf("unknown label mismatch policy: %d", policy))
+	}
+}
+
+// WithMissingLabelValue sets the value used by LabelMismatchFill for missing labels and for context labels
+// missing from the context, empty by default.
+func WithMissingLabelValue(value string) Option {
+	return func(c *Collector) error {
+		c.missingLabelValue = value
+		return nil
+	}
+}
+
+// WithDefaultMaxSeries limits the number of distinct label tuples of every metric without its own limit.
+func WithDefaultMaxSeries(limit int) Option {
+	return func(c *Collector) error {
+		c.defaultMaxSeries = limit
+		return nil
+	}
+}
+
+// WithMaxSeries limits the number of distinct label tuples of a single metric.
+func WithMaxSeries(name string, limit int) Option {
+	return func(c *Collector) error {
+		c.maxSeriesMap[name] = limit
+		return nil
+	}
+}
+
+// WithMaxTotalSeries limits the number of distinct label tuples of all the collector metrics together.
+func WithMaxTotalSeries(limit int) Option {
+	return func(c *Collector) error {
+		c.maxTotalSeries = int64(limit)
+		return nil
+	}
+}
+
+// WithCardinalityOverflowPolicy chooses what happens with new label tuples over the limits, CardinalityOverflowFold by default.
+func WithCardinalityOverflowPolicy(policy CardinalityOverflowPolicy) Option {
+	return func(c *Collector) error {
+		switch policy {
+		case CardinalityOverflowFold, CardinalityOverflowReject:
+			c.cardinalityOverflow = policy
+			return nil
+		}
+		return errors.New(fmt.Sprintf("unknown cardinality overflow policy: %d", policy))
+	}
+}
+
+// WithDefaultSeriesTTL deletes series of every metric without its own TTL when they are not updated within the ttl.
+func WithDefaultSeriesTTL(ttl time.Duration) Option {
+	return func(c *Collector) error {
+		c.defaultSeriesTTL = ttl
+		return nil
+	}
+}
+
+// WithSeriesTTL deletes series of a single metric when they are not updated within the ttl.
+func WithSeriesTTL(name string, ttl time.Duration) Option {
+	return func(c *Collector) error {
+		c.seriesTTLMap[name] = ttl
+		return nil
+	}
+}
+
+// WithJanitorInterval sets how often stale series are looked for, every minute by default.
+func WithJanitorInterval(interval time.Duration) Option {
+	return func(c *Collector) error {
+		if interval <= 0 {
+			return errors.New(fmt.Sprintf("janitor interval must be positive: %s", interval))
+		}
+		c.janitorInterval = interval
+		return nil
+	}
+}
+
+// WithClock replaces the clock series TTLs are measured with.
+func WithClock(clock Clock) Option {
+	return func(c *Collector) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		c.clock = clock
+		return nil
+	}
+}
+
+// WithNameSanitization converts metric and label names to snake_case and replaces invalid characters
+// with underscores before they are used. Names passed to other options are used as is.
+func WithNameSanitization() Option {
+	return func(c *Collector) error {
+		c.sanitizeNames = true
+		return nil
+	}
+}
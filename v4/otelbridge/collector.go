@@ -0,0 +1,266 @@
+// Package otelbridge connects the collector to OpenTelemetry in both directions: Collector records
+// interfaces.Collector observations through a MeterProvider and Producer exposes the metrics of a
+// Prometheus registry to OpenTelemetry readers.
+package otelbridge
+
+import (
+	"context"
+	"fmt"
+	prometheus_metrics "github.com/ifrolikov/prometheus_metrics/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"sync"
+	"time"
+)
+
+const scopeName = "github.com/ifrolikov/prometheus_metrics/v4/otelbridge"
+
+// Collector records observations through an OpenTelemetry meter. Instruments are created on the first
+// observation of a name and cached, labels are recorded as attributes. Timers and histograms are
+// histograms in seconds. Ctx methods pass the context to the instruments, so a sampled span in it
+// may be recorded as an exemplar.
+type Collector struct {
+	meter             metric.Meter
+	constAttributes   []attribute.KeyValue
+	buckets           map[string][]float64
+	contextLabelNames map[string][]string
+	missingLabelValue string
+
+	mtx        sync.RWMutex
+	histograms map[string]metric.Float64Histogram
+	counters   map[string]metric.Float64Counter
+	gauges     map[string]metric.Float64Gauge
+	// OpenTelemetry gauges are set only, so the values are kept for AddGauge and SubGauge.
+	gaugeValues map[string]float64
+}
+
+// NewCollector creates instruments with the meter of the provider named after this package.
+func NewCollector(provider metric.MeterProvider, options ...Option) (*Collector, error) {
+	c := &Collector{
+		meter:             provider.Meter(scopeName),
+		buckets:           make(map[string][]float64),
+		contextLabelNames: make(map[string][]string),
+		histograms:        make(map[string]metric.Float64Histogram),
+		counters:          make(map[string]metric.Float64Counter),
+		gauges:            make(map[string]metric.Float64Gauge),
+		gaugeValues:       make(map[string]float64),
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Collector) ObserveTimer(name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveTimerCtx(context.Background(), name, startTime, labels)
+}
+
+func (c *Collector) ObserveHistogram(name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveHistogramCtx(context.Background(), name, startTime, labels)
+}
+
+func (c *Collector) ObserveCounter(name string, inc int, labels map[string]string) error {
+	return c.ObserveCounterCtx(context.Background(), name, inc, labels)
+}
+
+func (c *Collector) ObserveCounterFloat(name string, inc float64, labels map[string]string) error {
+	return c.ObserveCounterFloatCtx(context.Background(), name, inc, labels)
+}
+
+// ObserveGauge sets the gauge to the passed value.
+func (c *Collector) ObserveGauge(name string, inc int, labels map[string]string) error {
+	return c.ObserveGaugeCtx(context.Background(), name, inc, labels)
+}
+
+func (c *Collector) SetGauge(name string, value float64, labels map[string]string) error {
+	return c.SetGaugeCtx(context.Background(), name, value, labels)
+}
+
+func (c *Collector) AddGauge(name string, value float64, labels map[string]string) error {
+	return c.AddGaugeCtx(context.Background(), name, value, labels)
+}
+
+func (c *Collector) SubGauge(name string, value float64, labels map[string]string) error {
+	return c.SubGaugeCtx(context.Background(), name, value, labels)
+}
+
+func (c *Collector) IncGauge(name string, labels map[string]string) error {
+	return c.IncGaugeCtx(context.Background(), name, labels)
+}
+
+func (c *Collector) DecGauge(name string, labels map[string]string) error {
+	return c.DecGaugeCtx(context.Background(), name, labels)
+}
+
+func (c *Collector) SetGaugeToCurrentTime(name string, labels map[string]string) error {
+	return c.SetGaugeToCurrentTimeCtx(context.Background(), name, labels)
+}
+
+func (c *Collector) ObserveTimerCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return c.recordHistogram(ctx, name, time.Since(startTime).Seconds(), labels)
+}
+
+func (c *Collector) ObserveHistogramCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return c.recordHistogram(ctx, name, time.Since(startTime).Seconds(), labels)
+}
+
+func (c *Collector) ObserveCounterCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return c.ObserveCounterFloatCtx(ctx, name, float64(inc), labels)
+}
+
+func (c *Collector) ObserveCounterFloatCtx(ctx context.Context, name string, inc float64, labels map[string]string) error {
+	if inc < 0 {
+		return fmt.Errorf("%w: %s by %v", prometheus_metrics.ErrCounterDecrease, name, inc)
+	}
+	counter, err := c.counter(name)
+	if err != nil {
+		return err
+	}
+	counter.Add(ctx, inc, metric.WithAttributes(c.attributes(ctx, name, labels)...))
+	return nil
+}
+
+func (c *Collector) ObserveGaugeCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return c.SetGaugeCtx(ctx, name, float64(inc), labels)
+}
+
+func (c *Collector) SetGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.updateGauge(ctx, name, labels, func(float64) float64 { return value })
+}
+
+func (c *Collector) AddGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.updateGauge(ctx, name, labels, func(current float64) float64 { return current + value })
+}
+
+func (c *Collector) SubGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.updateGauge(ctx, name, labels, func(current float64) float64 { return current - value })
+}
+
+func (c *Collector) IncGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.AddGaugeCtx(ctx, name, 1, labels)
+}
+
+func (c *Collector) DecGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.SubGaugeCtx(ctx, name, 1, labels)
+}
+
+func (c *Collector) SetGaugeToCurrentTimeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.SetGaugeCtx(ctx, name, float64(time.Now().UnixNano())/1e9, labels)
+}
+
+func (c *Collector) recordHistogram(ctx context.Context, name string, seconds float64, labels map[string]string) error {
+	histogram, err := c.histogram(name)
+	if err != nil {
+		return err
+	}
+	histogram.Record(ctx, seconds, metric.WithAttributes(c.attributes(ctx, name, labels)...))
+	return nil
+}
+
+func (c *Collector) updateGauge(ctx context.Context, name string, labels map[string]string, update func(current float64) float64) error {
+	gauge, err := c.gauge(name)
+	if err != nil {
+		return err
+	}
+	attributes := c.attributes(ctx, name, labels)
+	set := attribute.NewSet(attributes...)
+	key := name + "\xff" + set.Encoded(attribute.DefaultEncoder())
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	value := update(c.gaugeValues[key])
+	c.gaugeValues[key] = value
+	// Recording under the lock keeps the exported value in the order of the updates.
+	gauge.Record(ctx, value, metric.WithAttributeSet(set))
+	return nil
+}
+
+func (c *Collector) histogram(name string) (metric.Float64Histogram, error) {
+	c.mtx.RLock()
+	histogram, ok := c.histograms[name]
+	c.mtx.RUnlock()
+	if ok {
+		return histogram, nil
+	}
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if histogram, ok := c.histograms[name]; ok {
+		return histogram, nil
+	}
+	options := []metric.Float64HistogramOption{metric.WithUnit("s")}
+	if buckets, ok := c.buckets[name]; ok {
+		options = append(options, metric.WithExplicitBucketBoundaries(buckets...))
+	}
+	histogram, err := c.meter.Float64Histogram(name, options...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create histogram %s: %w", name, err)
+	}
+	c.histograms[name] = histogram
+	return histogram, nil
+}
+
+func (c *Collector) counter(name string) (metric.Float64Counter, error) {
+	c.mtx.RLock()
+	counter, ok := c.counters[name]
+	c.mtx.RUnlock()
+	if ok {
+		return counter, nil
+	}
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if counter, ok := c.counters[name]; ok {
+		return counter, nil
+	}
+	counter, err := c.meter.Float64Counter(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create counter %s: %w", name, err)
+	}
+	c.counters[name] = counter
+	return counter, nil
+}
+
+func (c *Collector) gauge(name string) (metric.Float64Gauge, error) {
+	c.mtx.RLock()
+	gauge, ok := c.gauges[name]
+	c.mtx.RUnlock()
+	if ok {
+		return gauge, nil
+	}
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if gauge, ok := c.gauges[name]; ok {
+		return gauge, nil
+	}
+	gauge, err := c.meter.Float64Gauge(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gauge %s: %w", name, err)
+	}
+	c.gauges[name] = gauge
+	return gauge, nil
+}
+
+// attributes merges the const attributes, the allowed context labels and the labels, later ones win.
+func (c *Collector) attributes(ctx context.Context, name string, labels map[string]string) []attribute.KeyValue {
+	merged := make(map[string]string, len(c.constAttributes)+len(labels))
+	for _, kv := range c.constAttributes {
+		merged[string(kv.Key)] = kv.Value.AsString()
+	}
+	for labelName, value := range prometheus_metrics.MergeContextLabels(ctx, c.contextLabelNames[name], c.missingLabelValue, labels) {
+		merged[labelName] = value
+	}
+
+	attributes := make([]attribute.KeyValue, 0, len(merged))
+	for key, value := range merged {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return attributes
+}
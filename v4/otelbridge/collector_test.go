@@ -0,0 +1,116 @@
+package otelbridge
+
+import (
+	"context"
+	prometheus_metrics "github.com/ifrolikov/prometheus_metrics/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"testing"
+	"time"
+)
+
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			data[m.Name] = m.Data
+		}
+	}
+	return data
+}
+
+func TestCollectorRecordsThroughMeterProvider(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	c, err := NewCollector(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		WithAttributes(map[string]string{"podname": "pod"}),
+		WithHistogramBuckets("request", []float64{0.5, 1}),
+		WithContextLabels("requests", "tenant"),
+		WithMissingLabelValue("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := prometheus_metrics.ContextWithLabels(context.Background(), map[string]string{"tenant": "acme"})
+	if err := c.ObserveCounterCtx(ctx, "requests", 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveTimer("request", time.Now(), map[string]string{"route": "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddGauge("queue", 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DecGauge("queue", nil); err != nil {
+		t.Fatal(err)
+	}
+	data := collect(t, reader)
+
+	sum, ok := data["requests"].(metricdata.Sum[float64])
+	if !ok || len(sum.DataPoints) != 2 {
+		t.Fatalf("requests = %#v, want a sum per tenant", data["requests"])
+	}
+	for _, dp := range sum.DataPoints {
+		tenant, _ := dp.Attributes.Value("tenant")
+		podname, _ := dp.Attributes.Value("podname")
+		want := map[string]float64{"acme": 2, "unknown": 1}[tenant.AsString()]
+		if dp.Value != want || podname.AsString() != "pod" {
+			t.Errorf("requests{%v} = %v, want %v", dp.Attributes.Encoded(attribute.DefaultEncoder()), dp.Value, want)
+		}
+	}
+
+	histogram, ok := data["request"].(metricdata.Histogram[float64])
+	if !ok || len(histogram.DataPoints) != 1 {
+		t.Fatalf("request = %#v, want a histogram", data["request"])
+	}
+	if dp := histogram.DataPoints[0]; dp.Count != 1 || len(dp.Bounds) != 2 || dp.Bounds[1] != 1 {
+		t.Errorf("request = %d observations in %v, want 1 in the configured buckets", dp.Count, dp.Bounds)
+	}
+
+	gauge, ok := data["queue"].(metricdata.Gauge[float64])
+	if !ok || len(gauge.DataPoints) != 1 || gauge.DataPoints[0].Value != 4 {
+		t.Errorf("queue = %#v, want 4", data["queue"])
+	}
+}
+
+func TestProducerConvertsGatheredMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"route"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "request_seconds", Help: "Latency.", Buckets: []float64{0.1, 1}})
+	registry.MustRegister(counter, histogram)
+	counter.WithLabelValues("/").Add(3)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(NewProducer(registry)))
+	sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	data := collect(t, reader)
+
+	sum, ok := data["requests_total"].(metricdata.Sum[float64])
+	if !ok || !sum.IsMonotonic || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 3 {
+		t.Errorf("requests_total = %#v, want a monotonic sum of 3", data["requests_total"])
+	}
+	h, ok := data["request_seconds"].(metricdata.Histogram[float64])
+	if !ok || len(h.DataPoints) != 1 {
+		t.Fatalf("request_seconds = %#v, want a histogram", data["request_seconds"])
+	}
+	dp := h.DataPoints[0]
+	wantCounts := []uint64{1, 1, 1}
+	if dp.Count != 3 || len(dp.Bounds) != 2 || len(dp.BucketCounts) != len(wantCounts) {
+		t.Fatalf("request_seconds = %d in %v %v, want 3 in per bucket counts", dp.Count, dp.Bounds, dp.BucketCounts)
+	}
+	for i, count := range wantCounts {
+		if dp.BucketCounts[i] != count {
+			t.Errorf("bucket %d = %d, want %d", i, dp.BucketCounts[i], count)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+module github.com/ifrolikov/prometheus_metrics/v4/otelbridge
+
+go 1.22.0
+
+require (
+	github.com/ifrolikov/prometheus_metrics/v4 v4.0.0-20261017002148-8f48f52286ae
+	github.com/prometheus/client_golang v1.13.1
+	github.com/prometheus/client_model v0.2.0
+	go.opentelemetry.io/otel v1.35.0
+	go.opentelemetry.io/otel/metric v1.35.0
+	go.opentelemetry.io/otel/sdk v1.35.0
+	go.opentelemetry.io/otel/sdk/metric v1.35.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/golang/snappy v1.0.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/iancoleman/strcase v0.2.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/common v0.37.0 // indirect
+	github.com/prometheus/procfs v0.8.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/trace v1.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+// The core is developed alongside the bridge. Consumers ignore the replace and get the required version,
+// which must be a core commit with every API the bridge uses.
+replace github.com/ifrolikov/prometheus_metrics/v4 => ../
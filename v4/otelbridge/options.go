@@ -0,0 +1,54 @@
+package otelbridge
+
+import (
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Option func(c *Collector) error
+
+// WithAttributes adds the attributes to every observation, e.g. the pod name.
+// Resource attributes of the MeterProvider are usually a better place for them.
+func WithAttributes(attributes map[string]string) Option {
+	return func(c *Collector) error {
+		for key, value := range attributes {
+			c.constAttributes = append(c.constAttributes, attribute.String(key, value))
+		}
+		return nil
+	}
+}
+
+// WithHistogramBuckets sets the bucket boundaries in seconds of the timer or histogram,
+// the boundaries of the SDK or of its views are used otherwise.
+func WithHistogramBuckets(name string, buckets []float64) Option {
+	return func(c *Collector) error {
+		if len(buckets) == 0 {
+			return errors.New(fmt.Sprintf("histogram buckets of %s must not be empty", name))
+		}
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				return errors.New(fmt.Sprintf("histogram buckets of %s must be in increasing order: %v", name, buckets))
+			}
+		}
+		c.buckets[name] = buckets
+		return nil
+	}
+}
+
+// WithContextLabels allows Ctx observations of the metric to take the label names from the context.
+// The attributes are always recorded, with the WithMissingLabelValue value if the context does not have them.
+func WithContextLabels(name string, labelNames ...string) Option {
+	return func(c *Collector) error {
+		c.contextLabelNames[name] = append(c.contextLabelNames[name], labelNames...)
+		return nil
+	}
+}
+
+// WithMissingLabelValue sets the value of context labels missing from the context, empty by default.
+func WithMissingLabelValue(value string) Option {
+	return func(c *Collector) error {
+		c.missingLabelValue = value
+		return nil
+	}
+}
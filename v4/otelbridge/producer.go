@@ -0,0 +1,145 @@
+package otelbridge
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"math"
+	"time"
+)
+
+// Producer exposes the metrics of a Prometheus gatherer to OpenTelemetry readers,
+// e.g. the registry of a collector with sdkmetric.WithProducer(otelbridge.NewProducer(collector.Gatherer())).
+// Counters become monotonic sums, gauges and untyped metrics gauges, histograms and summaries keep their type.
+// All of them are cumulative since the producer was created.
+type Producer struct {
+	gatherer  prometheus.Gatherer
+	startTime time.Time
+}
+
+var _ sdkmetric.Producer = (*Producer)(nil)
+
+func NewProducer(gatherer prometheus.Gatherer) *Producer {
+	return &Producer{gatherer: gatherer, startTime: time.Now()}
+}
+
+// Produce gathers the metrics. Like promhttp, it returns what was gathered along with a gathering error.
+func (p *Producer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	mfs, err := p.gatherer.Gather()
+	if len(mfs) == 0 {
+		return nil, err
+	}
+
+	now := time.Now()
+	metrics := make([]metricdata.Metrics, 0, len(mfs))
+	for _, mf := range mfs {
+		data := p.aggregation(mf, now)
+		if data == nil {
+			continue
+		}
+		metrics = append(metrics, metricdata.Metrics{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+			Data:        data,
+		})
+	}
+	return []metricdata.ScopeMetrics{{
+		Scope:   instrumentation.Scope{Name: scopeName},
+		Metrics: metrics,
+	}}, err
+}
+
+func (p *Producer) aggregation(mf *dto.MetricFamily, now time.Time) metricdata.Aggregation {
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+		for _, m := range mf.Metric {
+			sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: attributes(m.Label),
+				StartTime:  p.startTime,
+				Time:       now,
+				Value:      m.GetCounter().GetValue(),
+			})
+		}
+		return sum
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		var gauge metricdata.Gauge[float64]
+		for _, m := range mf.Metric {
+			value := m.GetGauge().GetValue()
+			if mf.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: attributes(m.Label),
+				Time:       now,
+				Value:      value,
+			})
+		}
+		return gauge
+	case dto.MetricType_HISTOGRAM:
+		histogram := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+		for _, m := range mf.Metric {
+			histogram.DataPoints = append(histogram.DataPoints, p.histogramDataPoint(m, now))
+		}
+		return histogram
+	case dto.MetricType_SUMMARY:
+		var summary metricdata.Summary
+		for _, m := range mf.Metric {
+			quantiles := make([]metricdata.QuantileValue, 0, len(m.GetSummary().GetQuantile()))
+			for _, q := range m.GetSummary().GetQuantile() {
+				quantiles = append(quantiles, metricdata.QuantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+			}
+			summary.DataPoints = append(summary.DataPoints, metricdata.SummaryDataPoint{
+				Attributes:     attributes(m.Label),
+				StartTime:      p.startTime,
+				Time:           now,
+				Count:          m.GetSummary().GetSampleCount(),
+				Sum:            m.GetSummary().GetSampleSum(),
+				QuantileValues: quantiles,
+			})
+		}
+		return summary
+	default:
+		return nil
+	}
+}
+
+// histogramDataPoint converts cumulative Prometheus buckets to OpenTelemetry per bucket counts
+// with the +Inf bucket implied by the last count.
+func (p *Producer) histogramDataPoint(m *dto.Metric, now time.Time) metricdata.HistogramDataPoint[float64] {
+	h := m.GetHistogram()
+	bounds := make([]float64, 0, len(h.GetBucket()))
+	counts := make([]uint64, 0, len(h.GetBucket())+1)
+	var previous uint64
+	for _, bucket := range h.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			break
+		}
+		bounds = append(bounds, bucket.GetUpperBound())
+		counts = append(counts, bucket.GetCumulativeCount()-previous)
+		previous = bucket.GetCumulativeCount()
+	}
+	counts = append(counts, h.GetSampleCount()-previous)
+
+	return metricdata.HistogramDataPoint[float64]{
+		Attributes:   attributes(m.Label),
+		StartTime:    p.startTime,
+		Time:         now,
+		Count:        h.GetSampleCount(),
+		Bounds:       bounds,
+		BucketCounts: counts,
+		Sum:          h.GetSampleSum(),
+	}
+}
+
+func attributes(labels []*dto.LabelPair) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		kvs = append(kvs, attribute.String(label.GetName(), label.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
@@ -0,0 +1,298 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"time"
+)
+
+type PushMethod int
+
+const (
+	// PushMethodPut replaces all the metrics of the grouping key on every push.
+	PushMethodPut PushMethod = iota
+	// PushMethodPost replaces only the metrics with the same names as the pushed ones.
+	PushMethodPost
+)
+
+type PushOption func(p *pusher) error
+
+type pusher struct {
+	url               string
+	job               string
+	interval          time.Duration
+	grouping          map[string]string
+	method            PushMethod
+	retries           int
+	backoff           time.Duration
+	client            push.HTTPDoer
+	basicAuthUser     string
+	basicAuthPassword string
+	errorHandler      func(err error)
+	stop              chan struct{}
+	done              chan struct{}
+	gatherer          prometheus.Gatherer
+	groupingLabels    map[string]string
+}
+
+// WithPushgateway pushes the collector registry to the Pushgateway at the url under the job
+// periodically and on Close. The grouping key is the pod name label unless WithPushGrouping is set.
+func WithPushgateway(url string, job string, options ...PushOption) Option {
+	return func(c *Collector) error {
+		if url == "" || job == "" {
+			return errors.New("pushgateway url and job must not be empty")
+		}
+		p := &pusher{
+			url:      url,
+			job:      job,
+			interval: 15 * time.Second,
+			method:   PushMethodPut,
+			retries:  3,
+			backoff:  time.Second,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}
+		for _, option := range options {
+			if err := option(p); err != nil {
+				return err
+			}
+		}
+		c.pusher = p
+		return nil
+	}
+}
+
+// WithPushInterval sets how often metrics are pushed, every 15s by default. Zero pushes only on Close and Push.
+func WithPushInterval(interval time.Duration) PushOption {
+	return func(p *pusher) error {
+		if interval < 0 {
+			return errors.New(fmt.Sprintf("push interval must not be negative: %s", interval))
+		}
+		p.interval = interval
+		return nil
+	}
+}
+
+// WithPushGrouping replaces the default grouping key.
+func WithPushGrouping(labels map[string]string) PushOption {
+	return func(p *pusher) error {
+		p.grouping = make(map[string]string, len(labels))
+		for labelName, value := range labels {
+			p.grouping[labelName] = value
+		}
+		return nil
+	}
+}
+
+// WithPushMethod selects PUT (the default) or POST semantics.
+func WithPushMethod(method PushMethod) PushOption {
+	return func(p *pusher) error {
+		if method != PushMethodPut && method != PushMethodPost {
+			return errors.New(fmt.Sprintf("unknown push method: %d", method))
+		}
+		p.method = method
+		return nil
+	}
+}
+
+// WithPushRetries retries a push failed with 5xx, 429 or a network error with the backoff doubled after every attempt,
+// 3 times from 1s by default.
+func WithPushRetries(retries int, backoff time.Duration) PushOption {
+	return func(p *pusher) error {
+		if retries < 0 || backoff < 0 {
+			return errors.New(fmt.Sprintf("push retries and backoff must not be negative: %d, %s", retries, backoff))
+		}
+		p.retries = retries
+		p.backoff = backoff
+		return nil
+	}
+}
+
+// WithPushHTTPClient replaces the default client with a 10s timeout.
+func WithPushHTTPClient(client push.HTTPDoer) PushOption {
+	return func(p *pusher) error {
+		if client == nil {
+			return errors.New("push http client must not be nil")
+		}
+		p.client = client
+		return nil
+	}
+}
+
+// WithPushBasicAuth authenticates pushes with the credentials.
+func WithPushBasicAuth(user string, password string) PushOption {
+	return func(p *pusher) error {
+		p.basicAuthUser = user
+		p.basicAuthPassword = password
+		return nil
+	}
+}
+
+// WithPushErrorHandler is called when a periodic push fails after all the retries.
+func WithPushErrorHandler(handler func(err error)) PushOption {
+	return func(p *pusher) error {
+		p.errorHandler = handler
+		return nil
+	}
+}
+
+// startPusher resolves the grouping key and starts periodic pushes. It runs after const labels are built.
+func (c *Collector) startPusher() {
+	p := c.pusher
+	p.groupingLabels = p.grouping
+	if p.groupingLabels == nil {
+		p.groupingLabels = map[string]string{}
+		if c.podNameLabel != "" {
+			p.groupingLabels[c.podNameLabel] = c.podName
+		}
+	}
+	p.gatherer = withoutGroupingLabels(c.gatherer, p.groupingLabels)
+	if p.interval == 0 {
+		return
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-p.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.push(ctx); err != nil && ctx.Err() == nil && p.errorHandler != nil {
+					p.errorHandler(err)
+				}
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopPusher stops periodic pushes and pushes the final state of the metrics until ctx is done.
+// The pusher is cleared, so closing again does not replace the final push with an empty one.
+func (c *Collector) stopPusher(ctx context.Context) error {
+	p := c.pusher
+	if p == nil {
+		return nil
+	}
+	c.pusher = nil
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+		p.stop = nil
+	}
+	return p.push(ctx)
+}
+
+// Push pushes the metrics to the Pushgateway configured by WithPushgateway right away.
+func (c *Collector) Push(ctx context.Context) error {
+	if c.pusher == nil {
+		return errors.New("pushgateway is not configured or the collector is closed")
+	}
+	return c.pusher.push(ctx)
+}
+
+func (p *pusher) push(ctx context.Context) error {
+	client := &statusRecordingClient{client: p.client}
+	pusher := push.New(p.url, p.job).Gatherer(p.gatherer).Client(client)
+	for labelName, value := range p.groupingLabels {
+		pusher = pusher.Grouping(labelName, value)
+	}
+	if p.basicAuthUser != "" {
+		pusher = pusher.BasicAuth(p.basicAuthUser, p.basicAuthPassword)
+	}
+
+	backoff := p.backoff
+	var err error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("push to %s interrupted: %w", p.url, err)
+			}
+			backoff *= 2
+		}
+		client.sent, client.status = false, 0
+		if p.method == PushMethodPost {
+			err = pusher.AddContext(ctx)
+		} else {
+			err = pusher.PushContext(ctx)
+		}
+		if err == nil {
+			return nil
+		}
+		if !client.recoverable() {
+			return fmt.Errorf("push to %s failed: %w", p.url, err)
+		}
+	}
+	return fmt.Errorf("push to %s failed after %d attempts: %w", p.url, p.retries+1, err)
+}
+
+// statusRecordingClient remembers the outcome of the last request, which the push library
+// reports only as an error message.
+type statusRecordingClient struct {
+	client push.HTTPDoer
+	sent   bool
+	status int
+}
+
+func (c *statusRecordingClient) Do(req *http.Request) (*http.Response, error) {
+	c.sent = true
+	resp, err := c.client.Do(req)
+	if resp != nil {
+		c.status = resp.StatusCode
+	}
+	return resp, err
+}
+
+// recoverable tells if the failed push may succeed when retried: the request failed
+// with a network error, 5xx or 429. Gathering errors and other statuses are final.
+func (c *statusRecordingClient) recoverable() bool {
+	if !c.sent {
+		return false
+	}
+	return c.status == 0 || c.status/100 == 5 || c.status == http.StatusTooManyRequests
+}
+
+// withoutGroupingLabels drops labels equal to the grouping key from the gathered metrics:
+// the Pushgateway adds them back, but refuses metrics that already have them.
+func withoutGroupingLabels(gatherer prometheus.Gatherer, grouping map[string]string) prometheus.Gatherer {
+	if len(grouping) == 0 {
+		return gatherer
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := gatherer.Gather()
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				labels := m.Label[:0]
+				for _, label := range m.Label {
+					if value, ok := grouping[label.GetName()]; !ok || value != label.GetValue() {
+						labels = append(labels, label)
+					}
+				}
+				m.Label = labels
+			}
+		}
+		return mfs, err
+	})
+}
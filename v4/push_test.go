@@ -0,0 +1,221 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pushRequest struct {
+	method   string
+	path     string
+	families map[string]*dto.MetricFamily
+}
+
+// fakePushgateway records pushes and answers with the queued statuses, 200 when they run out.
+type fakePushgateway struct {
+	t        *testing.T
+	mtx      sync.Mutex
+	statuses []int
+	requests []pushRequest
+}
+
+func (g *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families := make(map[string]*dto.MetricFamily)
+	decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := decoder.Decode(mf); err != nil {
+			if !errors.Is(err, io.EOF) {
+				g.t.Errorf("decoding the push: %v", err)
+			}
+			break
+		}
+		families[mf.GetName()] = mf
+	}
+
+	defer g.mtx.Unlock()
+	g.mtx.Lock()
+
+	g.requests = append(g.requests, pushRequest{method: r.Method, path: r.URL.Path, families: families})
+	status := http.StatusOK
+	if len(g.statuses) > 0 {
+		status, g.statuses = g.statuses[0], g.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (g *fakePushgateway) pushes() []pushRequest {
+	defer g.mtx.Unlock()
+	g.mtx.Lock()
+
+	return append([]pushRequest(nil), g.requests...)
+}
+
+func newPushCollector(t *testing.T, gateway *fakePushgateway, options ...PushOption) *Collector {
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	options = append([]PushOption{WithPushInterval(0), WithPushRetries(3, time.Millisecond)}, options...)
+	c, err := NewCollectorWithOptions("pod1", "ns", "sub",
+		WithRegistry(prometheus.NewRegistry()),
+		WithPushgateway(server.URL, "cron", options...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func hasLabel(m *dto.Metric, name string) bool {
+	for _, label := range m.Label {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPushMethodAndDefaultGrouping(t *testing.T) {
+	for method, want := range map[PushMethod]string{PushMethodPut: http.MethodPut, PushMethodPost: http.MethodPost} {
+		gateway := &fakePushgateway{t: t}
+		c := newPushCollector(t, gateway, WithPushMethod(method))
+		if err := c.Push(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		pushes := gateway.pushes()
+		if len(pushes) != 1 {
+			t.Fatalf("%s: pushes = %d, want 1", want, len(pushes))
+		}
+		if pushes[0].method != want || pushes[0].path != "/metrics/job/cron/podname/pod1" {
+			t.Errorf("pushed with %s %s, want %s grouped by the pod name", pushes[0].method, pushes[0].path, want)
+		}
+		requests, ok := pushes[0].families["ns_sub_requests"]
+		if !ok || requests.Metric[0].GetCounter().GetValue() != 3 {
+			t.Fatalf("pushed %v, want ns_sub_requests 3", pushes[0].families)
+		}
+		if hasLabel(requests.Metric[0], "podname") {
+			t.Errorf("the grouping label must be removed from the pushed series")
+		}
+	}
+}
+
+func TestPushGrouping(t *testing.T) {
+	gateway := &fakePushgateway{t: t}
+	c := newPushCollector(t, gateway, WithPushGrouping(map[string]string{"instance": "batch-1"}))
+	if err := c.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	pushes := gateway.pushes()
+	if pushes[0].path != "/metrics/job/cron/instance/batch-1" {
+		t.Errorf("pushed to %s, want the grouping key in the path", pushes[0].path)
+	}
+	if !hasLabel(pushes[0].families["ns_sub_requests"].Metric[0], "podname") {
+		t.Errorf("labels outside of the grouping key must be kept")
+	}
+}
+
+func TestPushRetriesRecoverableFailures(t *testing.T) {
+	gateway := &fakePushgateway{t: t, statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	c := newPushCollector(t, gateway)
+	if err := c.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pushes := len(gateway.pushes()); pushes != 3 {
+		t.Errorf("pushes = %d, want 2 failures and a success", pushes)
+	}
+
+	gateway = &fakePushgateway{t: t, statuses: []int{500, 500, 500, 500}}
+	c = newPushCollector(t, gateway)
+	if err := c.Push(context.Background()); err == nil {
+		t.Error("want an error after the retries are exhausted")
+	}
+	if pushes := len(gateway.pushes()); pushes != 4 {
+		t.Errorf("pushes = %d, want the first attempt and 3 retries", pushes)
+	}
+}
+
+func TestPushDoesNotRetryClientErrors(t *testing.T) {
+	gateway := &fakePushgateway{t: t, statuses: []int{http.StatusBadRequest}}
+	c := newPushCollector(t, gateway)
+	if err := c.Push(context.Background()); err == nil {
+		t.Fatal("want an error")
+	}
+	if pushes := len(gateway.pushes()); pushes != 1 {
+		t.Errorf("pushes = %d, a 400 must not be retried", pushes)
+	}
+}
+
+func TestCloseFlushesToPushgateway(t *testing.T) {
+	gateway := &fakePushgateway{t: t}
+	c := newPushCollector(t, gateway)
+	if err := c.ObserveCounter("requests", 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pushes := gateway.pushes()
+	if len(pushes) != 1 {
+		t.Fatalf("pushes = %d, want the final one", len(pushes))
+	}
+	if value := pushes[0].families["ns_sub_requests"].Metric[0].GetCounter().GetValue(); value != 5 {
+		t.Errorf("pushed %v, want the final value 5", value)
+	}
+}
+
+func TestCloseTwicePushesOnce(t *testing.T) {
+	gateway := &fakePushgateway{t: t}
+	c := newPushCollector(t, gateway)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Push(context.Background()); err == nil {
+		t.Error("want an error pushing after Close")
+	}
+
+	if pushes := gateway.pushes(); len(pushes) != 1 {
+		t.Errorf("pushes = %d, want only the final one", len(pushes))
+	}
+}
+
+func TestCloseContextAbandonsHangingPush(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, err := NewCollectorWithOptions("pod1", "ns", "sub",
+		WithRegistry(prometheus.NewRegistry()),
+		WithPushgateway(server.URL, "cron", WithPushInterval(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := c.CloseContext(ctx); err == nil {
+		t.Error("want an error for the abandoned push")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("CloseContext took %s", elapsed)
+	}
+}
@@ -0,0 +1,450 @@
+package prometheus_metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const remoteWriteVersion = "0.1.0"
+
+type RemoteWriteOption func(w *remoteWriter) error
+
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+type remoteWriteSample struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64
+}
+
+type remoteWriter struct {
+	collector         *Collector
+	url               string
+	interval          time.Duration
+	shards            int
+	queueCapacity     int
+	batchSize         int
+	retries           int
+	backoff           time.Duration
+	maxBackoff        time.Duration
+	client            *http.Client
+	headers           map[string]string
+	basicAuthUser     string
+	basicAuthPassword string
+
+	queues []chan remoteWriteSample
+	stop   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// ctx is cancelled when shutdown runs out of time, aborting requests and backoffs.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// WithRemoteWrite ships the samples of the collector registry to the Prometheus remote write endpoint
+// at the url on an interval and on Close. Samples are sharded by series over bounded queues,
+// samples that do not fit into a queue are dropped and counted.
+func WithRemoteWrite(url string, options ...RemoteWriteOption) Option {
+	return func(c *Collector) error {
+		if url == "" {
+			return errors.New("remote write url must not be empty")
+		}
+		w := &remoteWriter{
+			collector:     c,
+			url:           url,
+			interval:      15 * time.Second,
+			shards:        1,
+			queueCapacity: 10000,
+			batchSize:     500,
+			retries:       3,
+			backoff:       time.Second,
+			maxBackoff:    30 * time.Second,
+			client:        &http.Client{Timeout: 30 * time.Second},
+		}
+		for _, option := range options {
+			if err := option(w); err != nil {
+				return err
+			}
+		}
+		c.remoteWriter = w
+		return nil
+	}
+}
+
+// WithRemoteWriteInterval sets how often the registry is gathered and queued, every 15s by default.
+func WithRemoteWriteInterval(interval time.Duration) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		if interval <= 0 {
+			return errors.New(fmt.Sprintf("remote write interval must be positive: %s", interval))
+		}
+		w.interval = interval
+		return nil
+	}
+}
+
+// WithRemoteWriteShards sets the number of queues sending concurrently, 1 by default.
+func WithRemoteWriteShards(shards int) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		if shards <= 0 {
+			return errors.New(fmt.Sprintf("remote write shards must be positive: %d", shards))
+		}
+		w.shards = shards
+		return nil
+	}
+}
+
+// WithRemoteWriteQueueCapacity sets the number of samples every shard queue holds, 10000 by default.
+func WithRemoteWriteQueueCapacity(capacity int) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		if capacity <= 0 {
+			return errors.New(fmt.Sprintf("remote write queue capacity must be positive: %d", capacity))
+		}
+		w.queueCapacity = capacity
+		return nil
+	}
+}
+
+// WithRemoteWriteBatchSize sets the maximum number of samples in a request, 500 by default.
+func WithRemoteWriteBatchSize(size int) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		if size <= 0 {
+			return errors.New(fmt.Sprintf("remote write batch size must be positive: %d", size))
+		}
+		w.batchSize = size
+		return nil
+	}
+}
+
+// WithRemoteWriteRetries retries requests failed with 5xx, 429 or a network error, doubling the backoff
+// up to maxBackoff. Requests are retried 3 times from 1s up to 30s by default.
+func WithRemoteWriteRetries(retries int, backoff time.Duration, maxBackoff time.Duration) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		if retries < 0 || backoff < 0 || maxBackoff < backoff {
+			return errors.New(fmt.Sprintf("invalid remote write retries: %d from %s up to %s", retries, backoff, maxBackoff))
+		}
+		w.retries = retries
+		w.backoff = backoff
+		w.maxBackoff = maxBackoff
+		return nil
+	}
+}
+
+// WithRemoteWriteHTTPClient replaces the default client with a 30s timeout.
+func WithRemoteWriteHTTPClient(client *http.Client) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		if client == nil {
+			return errors.New("remote write http client must not be nil")
+		}
+		w.client = client
+		return nil
+	}
+}
+
+// WithRemoteWriteHeaders adds the headers to every request, e.g. a tenant id.
+func WithRemoteWriteHeaders(headers map[string]string) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		w.headers = make(map[string]string, len(headers))
+		for name, value := range headers {
+			w.headers[name] = value
+		}
+		return nil
+	}
+}
+
+// WithRemoteWriteBasicAuth authenticates requests with the credentials.
+func WithRemoteWriteBasicAuth(user string, password string) RemoteWriteOption {
+	return func(w *remoteWriter) error {
+		w.basicAuthUser = user
+		w.basicAuthPassword = password
+		return nil
+	}
+}
+
+func (w *remoteWriter) start() {
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.queues = make([]chan remoteWriteSample, w.shards)
+	for i := range w.queues {
+		w.queues[i] = make(chan remoteWriteSample, w.queueCapacity)
+		w.wg.Add(1)
+		go w.runShard(w.queues[i])
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.enqueue()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// shutdown queues the final samples and waits until the shards send everything queued or ctx is done.
+// Then requests in flight are aborted and the samples left are dropped and counted.
+func (w *remoteWriter) shutdown(ctx context.Context) error {
+	defer w.cancel()
+
+	close(w.stop)
+	<-w.done
+	w.enqueue()
+	for _, queue := range w.queues {
+		close(queue)
+	}
+	sent := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-sent
+		return fmt.Errorf("remote write to %s did not finish: %w", w.url, ctx.Err())
+	}
+}
+
+// enqueue gathers the registry and spreads the samples over the shards by series.
+func (w *remoteWriter) enqueue() {
+	mfs, err := w.collector.gatherer.Gather()
+	if err != nil && len(mfs) == 0 {
+		return
+	}
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	dropped := 0
+	for _, sample := range remoteWriteSamples(mfs, timestamp) {
+		queue := w.queues[int(hashRemoteWriteLabels(sample.labels)%uint64(len(w.queues)))]
+		select {
+		case queue <- sample:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		w.reportDropped("queue_full", dropped)
+	}
+}
+
+func (w *remoteWriter) runShard(queue chan remoteWriteSample) {
+	defer w.wg.Done()
+
+	batch := make([]remoteWriteSample, 0, w.batchSize)
+	for sample := range queue {
+		batch = append(batch, sample)
+	drain:
+		for len(batch) < w.batchSize {
+			select {
+			case sample, ok := <-queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, sample)
+			default:
+				break drain
+			}
+		}
+		w.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// send posts the batch retrying recoverable failures. Samples that cannot be sent are dropped and counted.
+func (w *remoteWriter) send(batch []remoteWriteSample) {
+	if w.ctx.Err() != nil {
+		w.reportDropped("shutdown", len(batch))
+		return
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(batch))
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		recoverable, err := w.post(body)
+		if err == nil {
+			w.reportSent(len(batch))
+			return
+		}
+		if w.ctx.Err() != nil {
+			w.reportDropped("shutdown", len(batch))
+			return
+		}
+		if !recoverable {
+			w.reportDropped("non_recoverable", len(batch))
+			return
+		}
+		if attempt == w.retries {
+			w.reportDropped("retries_exhausted", len(batch))
+			return
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-w.ctx.Done():
+			timer.Stop()
+			w.reportDropped("shutdown", len(batch))
+			return
+		}
+		backoff *= 2
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+func (w *remoteWriter) post(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+	if w.basicAuthUser != "" {
+		req.SetBasicAuth(w.basicAuthUser, w.basicAuthPassword)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = errors.New(fmt.Sprintf("remote write to %s failed with status %d", w.url, resp.StatusCode))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+func (w *remoteWriter) reportSent(samples int) {
+	counter := w.collector.selfCounter(&w.collector.remoteWriteSent, "remote_write_samples_sent_total",
+		"Samples sent to the remote write endpoint.", nil)
+	if counter != nil {
+		counter.WithLabelValues().Add(float64(samples))
+	}
+}
+
+func (w *remoteWriter) reportDropped(reason string, samples int) {
+	counter := w.collector.selfCounter(&w.collector.remoteWriteDropped, "remote_write_samples_dropped_total",
+		"Samples dropped instead of being sent to the remote write endpoint.", []string{"reason"})
+	if counter != nil {
+		counter.WithLabelValues(reason).Add(float64(samples))
+	}
+}
+
+// remoteWriteSamples flattens metric families the way Prometheus stores scraped ones:
+// summaries and histograms become quantile or bucket series with _sum and _count.
+func remoteWriteSamples(mfs []*dto.MetricFamily, timestamp int64) []remoteWriteSample {
+	var samples []remoteWriteSample
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			add := func(name string, value float64, extra ...remoteWriteLabel) {
+				labels := make([]remoteWriteLabel, 0, len(m.Label)+len(extra)+1)
+				labels = append(labels, remoteWriteLabel{name: "__name__", value: name})
+				for _, label := range m.Label {
+					labels = append(labels, remoteWriteLabel{name: label.GetName(), value: label.GetValue()})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				samples = append(samples, remoteWriteSample{labels: labels, value: value, timestamp: timestamp})
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().GetQuantile() {
+					add(name, q.GetValue(), remoteWriteLabel{name: "quantile", value: formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", m.GetSummary().GetSampleSum())
+				add(name+"_count", float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				for _, b := range m.GetHistogram().GetBucket() {
+					add(name+"_bucket", float64(b.GetCumulativeCount()), remoteWriteLabel{name: "le", value: formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(m.GetHistogram().GetSampleCount()), remoteWriteLabel{name: "le", value: "+Inf"})
+				add(name+"_sum", m.GetHistogram().GetSampleSum())
+				add(name+"_count", float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func hashRemoteWriteLabels(labels []remoteWriteLabel) uint64 {
+	hash := fnv.New64a()
+	for _, label := range labels {
+		_, _ = hash.Write([]byte(label.name))
+		_, _ = hash.Write([]byte{0})
+		_, _ = hash.Write([]byte(label.value))
+		_, _ = hash.Write([]byte{0})
+	}
+	return hash.Sum64()
+}
+
+// encodeWriteRequest encodes prometheus.WriteRequest with a time series per sample:
+// WriteRequest{1: repeated TimeSeries}, TimeSeries{1: repeated Label, 2: repeated Sample},
+// Label{1: name, 2: value}, Sample{1: double value, 2: int64 timestamp}.
+func encodeWriteRequest(samples []remoteWriteSample) []byte {
+	var request []byte
+	for _, sample := range samples {
+		var series []byte
+		for _, label := range sample.labels {
+			var encodedLabel []byte
+			encodedLabel = protowire.AppendTag(encodedLabel, 1, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, label.name)
+			encodedLabel = protowire.AppendTag(encodedLabel, 2, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, label.value)
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, encodedLabel)
+		}
+		var encodedSample []byte
+		encodedSample = protowire.AppendTag(encodedSample, 1, protowire.Fixed64Type)
+		encodedSample = protowire.AppendFixed64(encodedSample, math.Float64bits(sample.value))
+		encodedSample = protowire.AppendTag(encodedSample, 2, protowire.VarintType)
+		encodedSample = protowire.AppendVarint(encodedSample, uint64(sample.timestamp))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, encodedSample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+	return request
+}
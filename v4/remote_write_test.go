@@ -0,0 +1,332 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type decodedSample struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// fakeReceiver decodes remote write requests and answers with the queued statuses, 204 when they run out.
+type fakeReceiver struct {
+	t        *testing.T
+	mtx      sync.Mutex
+	statuses []int
+	requests int
+	samples  []decodedSample
+	headers  http.Header
+}
+
+func (f *fakeReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.t.Errorf("reading the request: %v", err)
+	}
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		f.t.Errorf("snappy-decoding the request: %v", err)
+	}
+
+	defer f.mtx.Unlock()
+	f.mtx.Lock()
+
+	f.requests++
+	f.headers = r.Header
+	if len(f.statuses) > 0 {
+		status := f.statuses[0]
+		f.statuses = f.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	f.samples = append(f.samples, decodeWriteRequest(f.t, body)...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeReceiver) received() (int, []decodedSample) {
+	defer f.mtx.Unlock()
+	f.mtx.Lock()
+
+	return f.requests, append([]decodedSample(nil), f.samples...)
+}
+
+// decodeWriteRequest decodes the prometheus.WriteRequest fields written by encodeWriteRequest.
+func decodeWriteRequest(t *testing.T, body []byte) []decodedSample {
+	var samples []decodedSample
+	forEachField(t, body, func(number protowire.Number, bytes []byte, _ uint64) {
+		if number != 1 {
+			return
+		}
+		sample := decodedSample{labels: make(map[string]string)}
+		forEachField(t, bytes, func(number protowire.Number, bytes []byte, _ uint64) {
+			switch number {
+			case 1:
+				var name, value string
+				forEachField(t, bytes, func(number protowire.Number, bytes []byte, _ uint64) {
+					if number == 1 {
+						name = string(bytes)
+					} else {
+						value = string(bytes)
+					}
+				})
+				sample.labels[name] = value
+			case 2:
+				forEachField(t, bytes, func(number protowire.Number, _ []byte, scalar uint64) {
+					if number == 1 {
+						sample.value = math.Float64frombits(scalar)
+					} else {
+						sample.timestamp = int64(scalar)
+					}
+				})
+			}
+		})
+		samples = append(samples, sample)
+	})
+	return samples
+}
+
+func forEachField(t *testing.T, b []byte, field func(number protowire.Number, bytes []byte, scalar uint64)) {
+	for len(b) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("malformed tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch fieldType {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("malformed bytes: %v", protowire.ParseError(n))
+			}
+			field(number, value, 0)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				t.Fatalf("malformed fixed64: %v", protowire.ParseError(n))
+			}
+			field(number, nil, value)
+			b = b[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatalf("malformed varint: %v", protowire.ParseError(n))
+			}
+			field(number, nil, value)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", fieldType)
+		}
+	}
+}
+
+// counterValue returns the value of the series of the counter with the label, or with no labels if labelName is empty.
+func counterValue(t *testing.T, gatherer prometheus.Gatherer, name string, labelName string, labelValue string) float64 {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if labelName == "" || label.GetName() == labelName && label.GetValue() == labelValue {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRemoteWriteEncodesSamples(t *testing.T) {
+	receiver := &fakeReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(prometheus.NewRegistry()),
+		WithRemoteWrite(server.URL,
+			WithRemoteWriteInterval(time.Hour),
+			WithRemoteWriteHeaders(map[string]string{"X-Scope-OrgID": "tenant"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 3, map[string]string{"route": "/users"}); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, samples := receiver.received()
+	if len(samples) != 1 {
+		t.Fatalf("samples = %v, want only the counter", samples)
+	}
+	sample := samples[0]
+	wantLabels := map[string]string{"__name__": "ns_sub_requests", "podname": "pod", "route": "/users"}
+	if len(sample.labels) != len(wantLabels) {
+		t.Errorf("labels = %v, want %v", sample.labels, wantLabels)
+	}
+	for name, value := range wantLabels {
+		if sample.labels[name] != value {
+			t.Errorf("label %s = %q, want %q", name, sample.labels[name], value)
+		}
+	}
+	if sample.value != 3 || sample.timestamp < before {
+		t.Errorf("sample = %v at %d, want 3 at %d or later", sample.value, sample.timestamp, before)
+	}
+	for name, value := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": remoteWriteVersion,
+		"X-Scope-OrgID":                     "tenant",
+	} {
+		if receiver.headers.Get(name) != value {
+			t.Errorf("header %s = %q, want %q", name, receiver.headers.Get(name), value)
+		}
+	}
+}
+
+func TestRemoteWriteRetriesRecoverableFailures(t *testing.T) {
+	receiver := &fakeReceiver{t: t, statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithRemoteWrite(server.URL,
+			WithRemoteWriteInterval(10*time.Millisecond),
+			WithRemoteWriteRetries(3, time.Millisecond, time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.ObserveCounter("requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the retried samples to be sent", func() bool {
+		return counterValue(t, registry, "ns_sub_remote_write_samples_sent_total", "", "") > 0
+	})
+	if requests, _ := receiver.received(); requests < 3 {
+		t.Errorf("requests = %d, want 2 failures before the success", requests)
+	}
+	if dropped := counterValue(t, registry, "ns_sub_remote_write_samples_dropped_total", "reason", "retries_exhausted"); dropped != 0 {
+		t.Errorf("dropped %v samples, want the retries to succeed", dropped)
+	}
+}
+
+func TestRemoteWriteDropsClientErrors(t *testing.T) {
+	receiver := &fakeReceiver{t: t, statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithRemoteWrite(server.URL,
+			WithRemoteWriteInterval(10*time.Millisecond),
+			WithRemoteWriteRetries(3, time.Millisecond, time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.ObserveCounter("requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the rejected samples to be dropped", func() bool {
+		return counterValue(t, registry, "ns_sub_remote_write_samples_dropped_total", "reason", "non_recoverable") > 0
+	})
+}
+
+func TestRemoteWriteCountsFullQueueDrops(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithRemoteWrite(server.URL,
+			WithRemoteWriteInterval(10*time.Millisecond),
+			WithRemoteWriteQueueCapacity(1),
+			WithRemoteWriteBatchSize(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		if err := c.ObserveCounter("requests", 1, map[string]string{"route": route}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "samples dropped from the full queue", func() bool {
+		return counterValue(t, registry, "ns_sub_remote_write_samples_dropped_total", "reason", "queue_full") > 0
+	})
+	close(release)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteWriteShutdownIsBounded(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(prometheus.NewRegistry()),
+		WithRemoteWrite(server.URL, WithRemoteWriteInterval(time.Hour), WithRemoteWriteBatchSize(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"/a", "/b", "/c"} {
+		if err := c.ObserveCounter("requests", 1, map[string]string{"route": route}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := c.CloseContext(ctx); err == nil {
+		t.Error("want an error for the samples left unsent")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("CloseContext took %s", elapsed)
+	}
+}
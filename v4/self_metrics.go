@@ -0,0 +1,118 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// selfMetrics describes the collector itself under a namespace of its own.
+type selfMetrics struct {
+	collector         *Collector
+	registeredMetrics *prometheus.Desc
+	series            *prometheus.Desc
+	errors            *prometheus.CounterVec
+	registrations     *prometheus.CounterVec
+	lockHold          prometheus.Histogram
+}
+
+func newSelfMetrics(c *Collector, namespace string) *selfMetrics {
+	constLabels := prometheus.Labels(c.constLabels)
+	errorLabelNames := []string{"kind"}
+	if c.countErrorsByMetric {
+		errorLabelNames = []string{"metric", "kind"}
+	}
+	return &selfMetrics{
+		collector: c,
+		registeredMetrics: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "registered_metrics"),
+			"Metrics registered by the collector by type.", []string{"type"}, constLabels),
+		series: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "series"),
+			"Live series of the metric.", []string{"metric"}, constLabels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "observation_errors_total",
+			Help:        "Failed observations by error kind.",
+			ConstLabels: constLabels,
+		}, errorLabelNames),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "registrations_total",
+			Help:        "Metrics registered by the collector by type.",
+			ConstLabels: constLabels,
+		}, []string{"type"}),
+		lockHold: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "registration_lock_hold_seconds",
+			Help:        "Time the registration lock is held for a single registration.",
+			Buckets:     prometheus.ExponentialBuckets(0.00001, 4, 8),
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+func (s *selfMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.registeredMetrics
+	ch <- s.series
+	s.errors.Describe(ch)
+	s.registrations.Describe(ch)
+	s.lockHold.Describe(ch)
+}
+
+// Collect reads metric maps without the collector lock. The series of every metric are tracked
+// while self metrics are enabled, so counting them does not collect the metrics.
+func (s *selfMetrics) Collect(ch chan<- prometheus.Metric) {
+	c := s.collector
+	for metricType, metrics := range map[MetricType]*readMostlyMap{
+		MetricTypeTimer:     &c.timeMetrics,
+		MetricTypeHistogram: &c.histogramMetrics,
+		MetricTypeCounter:   &c.counterMetrics,
+		MetricTypeGauge:     &c.gaugeMetrics,
+	} {
+		items := metrics.snapshot()
+		ch <- prometheus.MustNewConstMetric(s.registeredMetrics, prometheus.GaugeValue, float64(len(items)), string(metricType))
+		for _, item := range items {
+			m := item.(*metric)
+			if m.series == nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(s.series, prometheus.GaugeValue, float64(countSeries(m)), m.name)
+		}
+	}
+	s.errors.Collect(ch)
+	s.registrations.Collect(ch)
+	s.lockHold.Collect(ch)
+}
+
+func countSeries(m *metric) int {
+	defer m.series.mtx.RUnlock()
+	m.series.mtx.RLock()
+
+	return m.series.count
+}
+
+// WithSelfMetrics exposes metrics about the collector itself under the namespace,
+// separate from the namespace of the service metrics. The counters of label mismatches,
+// cardinality overflows, observation errors and remote write samples move there as well.
+func WithSelfMetrics(namespace string) Option {
+	return func(c *Collector) error {
+		if namespace == "" {
+			return errors.New("self metrics namespace must not be empty")
+		}
+		c.selfMetricsNamespace = namespace
+		return nil
+	}
+}
+
+// registerLocked runs the registration under the collector lock and measures how long the lock is held.
+func (c *Collector) registerLocked(init func() (*metric, error)) (*metric, error) {
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	if c.selfMetrics == nil {
+		return init()
+	}
+	start := time.Now()
+	m, err := init()
+	c.selfMetrics.lockHold.Observe(time.Since(start).Seconds())
+	return m, err
+}
@@ -0,0 +1,92 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestSelfMetricsKeepCollectorCountersOutOfTheServiceNamespace(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(registry),
+		WithSelfMetrics("metrics_lib"),
+		WithErrorCounter(),
+		WithMaxSeries("requests", 1),
+		WithCardinalityOverflowPolicy(CardinalityOverflowReject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, map[string]string{"route": "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.ObserveCounter("requests", 1, map[string]string{"route": "/b"})
+	_ = c.ObserveCounter("requests", 1, map[string]string{"code": "200"})
+	if err := c.SetGauge("untracked", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := make(map[string][]string)
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == "metric" {
+					families[mf.GetName()] = append(families[mf.GetName()], label.GetValue())
+				}
+			}
+		}
+		if _, ok := families[mf.GetName()]; !ok {
+			families[mf.GetName()] = nil
+		}
+	}
+	for _, name := range []string{
+		"metrics_lib_label_mismatches_total",
+		"metrics_lib_cardinality_overflows_total",
+		"metrics_lib_observation_errors_total",
+		"ns_sub_requests",
+		"ns_sub_untracked",
+	} {
+		if _, ok := families[name]; !ok {
+			t.Errorf("%s is not gathered: %v", name, families)
+		}
+	}
+	for _, name := range []string{"ns_sub_label_mismatches_total", "ns_sub_cardinality_overflows_total", "ns_sub_observation_errors_total"} {
+		if _, ok := families[name]; ok {
+			t.Errorf("%s pollutes the service namespace", name)
+		}
+	}
+	if series := families["metrics_lib_series"]; len(series) != 2 {
+		t.Errorf("series reported for %v, want requests and untracked", series)
+	}
+}
+
+func TestSelfMetricsCountSeriesWithoutLimits(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry), WithSelfMetrics("metrics_lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"/a", "/b", "/c", "/a"} {
+		if err := c.ObserveCounter("requests", 1, map[string]string{"route": route}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.SetGauge("in_flight", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]float64{"requests": 3, "in_flight": 1} {
+		if value, ok := seriesValue(t, registry, "metrics_lib_series", map[string]string{"metric": name}); !ok || value != want {
+			t.Errorf("series{metric=%q} = %v, want %v", name, value, want)
+		}
+	}
+	if err := c.DeleteSeries("requests", map[string]string{"route": "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := seriesValue(t, registry, "metrics_lib_series", map[string]string{"metric": "requests"}); value != 2 {
+		t.Errorf("series after DeleteSeries = %v, want 2", value)
+	}
+}
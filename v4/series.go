@@ -0,0 +1,231 @@
+package prometheus_metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const overflowLabelValue = "__overflow__"
+
+type CardinalityOverflowPolicy int
+
+const (
+	// CardinalityOverflowFold observes new label tuples over the limit into a series with all label values set to "__overflow__".
+	CardinalityOverflowFold CardinalityOverflowPolicy = iota
+	// CardinalityOverflowReject returns an error for new label tuples over the limit.
+	CardinalityOverflowReject
+)
+
+type series struct {
+	labelValues []string
+	lastSeen    int64
+	pinned      bool
+}
+
+// seriesSet tracks distinct label tuples of a metric. It exists only for metrics with a series limit or TTL.
+// Series are bucketed by the hash of their label values and told apart by the values themselves,
+// so tuples with colliding hashes are still separate series.
+type seriesSet struct {
+	mtx            sync.RWMutex
+	series         map[uint64][]*series
+	count          int
+	limit          int
+	ttl            time.Duration
+	overflowLabels map[string]string
+}
+
+func (c *Collector) newSeriesSet(name string, labelNames []string) *seriesSet {
+	limit, ok := c.maxSeriesMap[name]
+	if !ok {
+		limit = c.defaultMaxSeries
+	}
+	ttl, ok := c.seriesTTLMap[name]
+	if !ok {
+		ttl = c.defaultSeriesTTL
+	}
+	// Self metrics report the live series of every metric, so they are tracked even without limits.
+	if limit <= 0 && ttl <= 0 && c.maxTotalSeries <= 0 && c.selfMetrics == nil {
+		return nil
+	}
+
+	overflowLabels := make(map[string]string, len(labelNames))
+	for _, labelName := range labelNames {
+		overflowLabels[labelName] = overflowLabelValue
+	}
+	return &seriesSet{
+		series:         make(map[uint64][]*series),
+		limit:          limit,
+		ttl:            ttl,
+		overflowLabels: overflowLabels,
+	}
+}
+
+// admitSeries returns the labels the observation has to be recorded with: the passed ones for known
+// label tuples and for new tuples within the limits, the overflow tuple otherwise.
+func (c *Collector) admitSeries(name string, m *metric, labels map[string]string, pin bool) (map[string]string, error) {
+	if m.series == nil {
+		return labels, nil
+	}
+	hash := hashLabelValues(m.labelNames, labels)
+
+	m.series.mtx.RLock()
+	known := m.series.find(hash, m.labelNames, labels)
+	if known != nil && m.series.ttl > 0 {
+		atomic.StoreInt64(&known.lastSeen, c.clock.Now().UnixNano())
+	}
+	m.series.mtx.RUnlock()
+	if known != nil && !pin {
+		return labels, nil
+	}
+
+	m.series.mtx.Lock()
+	if known := m.series.find(hash, m.labelNames, labels); known != nil {
+		known.pinned = known.pinned || pin
+		m.series.mtx.Unlock()
+		return labels, nil
+	}
+	overflowed := m.series.limit > 0 && m.series.count >= m.series.limit
+	collectorWide := false
+	if !overflowed && c.maxTotalSeries > 0 {
+		overflowed = atomic.AddInt64(&c.totalSeries, 1) > c.maxTotalSeries
+		if overflowed {
+			atomic.AddInt64(&c.totalSeries, -1)
+			collectorWide = true
+		}
+	}
+	if !overflowed {
+		labelValues := make([]string, len(m.labelNames))
+		for i, labelName := range m.labelNames {
+			labelValues[i] = labels[labelName]
+		}
+		m.series.series[hash] = append(m.series.series[hash], &series{
+			labelValues: labelValues,
+			lastSeen:    c.clock.Now().UnixNano(),
+			pinned:      pin,
+		})
+		m.series.count++
+	}
+	m.series.mtx.Unlock()
+	if !overflowed {
+		return labels, nil
+	}
+
+	if c.cardinalityOverflow == CardinalityOverflowReject {
+		c.reportCardinalityOverflow(name, "rejected")
+		limitErr := &CardinalityLimitError{Name: name, Limit: int64(m.series.limit), CollectorWide: collectorWide}
+		if collectorWide {
+			limitErr.Limit = c.maxTotalSeries
+		}
+		return nil, limitErr
+	}
+	c.reportCardinalityOverflow(name, "folded")
+	return m.series.overflowLabels, nil
+}
+
+func (c *Collector) reportCardinalityOverflow(name string, action string) {
+	counter := c.selfCounter(&c.cardinalityOverflows, "cardinality_overflows_total",
+		"Observations of new label tuples over the series limit.", []string{"metric", "action"})
+	if counter != nil {
+		counter.WithLabelValues(name, action).Inc()
+	}
+}
+
+type labelValuesDeleter interface {
+	DeleteLabelValues(labelValues ...string) bool
+}
+
+// ExpireStaleSeries deletes the series that were not updated within their metric TTL.
+// It is run by the janitor and may be called directly, e.g. in tests with an injected Clock.
+func (c *Collector) ExpireStaleSeries() {
+	now := c.clock.Now().UnixNano()
+	for _, metrics := range []*readMostlyMap{&c.timeMetrics, &c.histogramMetrics, &c.counterMetrics, &c.gaugeMetrics} {
+		for _, item := range metrics.snapshot() {
+			m := item.(*metric)
+			if m.series == nil || m.series.ttl <= 0 {
+				continue
+			}
+			c.expireStaleSeries(m, now)
+		}
+	}
+}
+
+func (c *Collector) expireStaleSeries(m *metric, now int64) {
+	deleter := m.vec.(labelValuesDeleter)
+	ttl := m.series.ttl.Nanoseconds()
+
+	defer m.series.mtx.Unlock()
+	m.series.mtx.Lock()
+
+	for hash, bucket := range m.series.series {
+		for _, s := range bucket {
+			if s.pinned || now-atomic.LoadInt64(&s.lastSeen) <= ttl {
+				continue
+			}
+			deleter.DeleteLabelValues(s.labelValues...)
+			m.series.remove(hash, s)
+			c.releaseSeries(1)
+		}
+	}
+}
+
+// find returns the series with the label values or nil. The caller holds the set lock.
+func (s *seriesSet) find(hash uint64, labelNames []string, labels map[string]string) *series {
+	for _, candidate := range s.series[hash] {
+		if candidate.matches(labelNames, labels) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// remove deletes the series from its bucket. The caller holds the set lock for writing.
+func (s *seriesSet) remove(hash uint64, target *series) {
+	bucket := s.series[hash]
+	for i, candidate := range bucket {
+		if candidate != target {
+			continue
+		}
+		if len(bucket) == 1 {
+			delete(s.series, hash)
+		} else {
+			s.series[hash] = append(bucket[:i:i], bucket[i+1:]...)
+		}
+		s.count--
+		return
+	}
+}
+
+func (s *series) matches(labelNames []string, labels map[string]string) bool {
+	for i, labelName := range labelNames {
+		if s.labelValues[i] != labels[labelName] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Collector) releaseSeries(count int) {
+	if c.maxTotalSeries > 0 {
+		atomic.AddInt64(&c.totalSeries, -int64(count))
+	}
+}
+
+// hashLabelValues is FNV-1a over the label values in label names order.
+func hashLabelValues(labelNames []string, labels map[string]string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for _, labelName := range labelNames {
+		value := labels[labelName]
+		for i := 0; i < len(value); i++ {
+			hash ^= uint64(value[i])
+			hash *= prime64
+		}
+		hash ^= 0xff
+		hash *= prime64
+	}
+	return hash
+}
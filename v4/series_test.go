@@ -0,0 +1,76 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestSeriesWithCollidingHashesAreSeparate(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()), WithMaxSeries("requests", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := map[string]string{"route": "/a"}
+	second := map[string]string{"route": "/b"}
+	if err := c.ObserveCounter("requests", 1, first); err != nil {
+		t.Fatal(err)
+	}
+	item, _ := c.counterMetrics.load("requests")
+	m := item.(*metric)
+
+	// Move the first series under the hash of the second one, as if their hashes collided.
+	m.series.mtx.Lock()
+	firstSeries := m.series.find(hashLabelValues(m.labelNames, first), m.labelNames, first)
+	m.series.remove(hashLabelValues(m.labelNames, first), firstSeries)
+	collidingHash := hashLabelValues(m.labelNames, second)
+	m.series.series[collidingHash] = []*series{firstSeries}
+	m.series.count++
+	m.series.mtx.Unlock()
+
+	if err := c.ObserveCounter("requests", 1, second); err != nil {
+		t.Fatal(err)
+	}
+	if count := countSeries(m); count != 2 {
+		t.Fatalf("series = %d, want 2", count)
+	}
+	m.series.mtx.Lock()
+	m.series.remove(collidingHash, m.series.find(collidingHash, m.labelNames, first))
+	remaining := m.series.find(collidingHash, m.labelNames, second)
+	m.series.mtx.Unlock()
+	if remaining == nil || countSeries(m) != 1 {
+		t.Errorf("removing the first series must keep the second one tracked")
+	}
+}
+
+func TestCardinalityOverflowDoesNotTakeCollectorLock(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(registry), WithMaxSeries("requests", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"/a", "/b"} {
+		if err := c.ObserveCounter("requests", 1, map[string]string{"route": route}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.mtx.Lock()
+	done := make(chan error)
+	go func() {
+		done <- c.ObserveCounter("requests", 1, map[string]string{"route": "/c"})
+	}()
+	select {
+	case err := <-done:
+		c.mtx.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		c.mtx.Unlock()
+		t.Fatal("folding an observation over the limit waited for the collector lock")
+	}
+	if overflows := counterValue(t, registry, "ns_sub_cardinality_overflows_total", "metric", "requests"); overflows != 2 {
+		t.Errorf("overflows = %v, want 2", overflows)
+	}
+}
@@ -0,0 +1,290 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultListenAddress   = ":2112"
+	defaultMetricsPath     = "/metrics"
+	defaultLivenessPath    = "/healthz"
+	defaultReadinessPath   = "/readyz"
+	defaultShutdownTimeout = 5 * time.Second
+)
+
+type ServerOption func(s *Server) error
+
+// Server exposes the metrics of the collector registry over HTTP with liveness and readiness endpoints.
+// Health endpoints are never behind basic auth, so probes do not need credentials.
+type Server struct {
+	collector          *Collector
+	address            string
+	metricsPath        string
+	livenessPath       string
+	readinessPath      string
+	disableCompression bool
+	disableOpenMetrics bool
+	basicAuthUser      string
+	basicAuthPassword  string
+	tlsConfig          *tls.Config
+	readinessCheck     func() error
+	shutdownTimeout    time.Duration
+	shuttingDown       int32
+
+	mtx        sync.Mutex
+	httpServer *http.Server
+	listener   net.Listener
+	done       chan error
+	stopped    chan struct{}
+}
+
+// WithListenAddress sets the address the server listens on, :2112 by default.
+func WithListenAddress(address string) ServerOption {
+	return func(s *Server) error {
+		s.address = address
+		return nil
+	}
+}
+
+// WithMetricsPath sets the path metrics are served on, /metrics by default.
+func WithMetricsPath(path string) ServerOption {
+	return func(s *Server) error {
+		if !strings.HasPrefix(path, "/") {
+			return errors.New(fmt.Sprintf("metrics path must start with /: %s", path))
+		}
+		s.metricsPath = path
+		return nil
+	}
+}
+
+// WithHealthPaths sets the liveness and readiness paths, /healthz and /readyz by default.
+func WithHealthPaths(livenessPath string, readinessPath string) ServerOption {
+	return func(s *Server) error {
+		if !strings.HasPrefix(livenessPath, "/") || !strings.HasPrefix(readinessPath, "/") {
+			return errors.New(fmt.Sprintf("health paths must start with /: %s, %s", livenessPath, readinessPath))
+		}
+		s.livenessPath = livenessPath
+		s.readinessPath = readinessPath
+		return nil
+	}
+}
+
+// WithoutCompression disables gzip compression of the responses.
+func WithoutCompression() ServerOption {
+	return func(s *Server) error {
+		s.disableCompression = true
+		return nil
+	}
+}
+
+// WithoutOpenMetrics always serves the Prometheus text format, even if the scraper accepts OpenMetrics.
+func WithoutOpenMetrics() ServerOption {
+	return func(s *Server) error {
+		s.disableOpenMetrics = true
+		return nil
+	}
+}
+
+// WithBasicAuth requires the credentials for the metrics path.
+func WithBasicAuth(user string, password string) ServerOption {
+	return func(s *Server) error {
+		if user == "" || password == "" {
+			return errors.New("basic auth user and password must not be empty")
+		}
+		s.basicAuthUser = user
+		s.basicAuthPassword = password
+		return nil
+	}
+}
+
+// WithTLSFiles serves HTTPS with the certificate and key loaded from the files.
+func WithTLSFiles(certFile string, keyFile string) ServerOption {
+	return func(s *Server) error {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("cannot load TLS certificate: %w", err)
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+		return nil
+	}
+}
+
+// WithReadinessCheck makes the readiness endpoint fail while the check returns an error.
+// The server is not ready while it is shutting down regardless of the check.
+func WithReadinessCheck(check func() error) ServerOption {
+	return func(s *Server) error {
+		s.readinessCheck = check
+		return nil
+	}
+}
+
+// WithShutdownTimeout limits how long the server waits for in-flight requests when its context is done, 5s by default.
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) error {
+		if timeout <= 0 {
+			return errors.New(fmt.Sprintf("shutdown timeout must be positive: %s", timeout))
+		}
+		s.shutdownTimeout = timeout
+		return nil
+	}
+}
+
+// checkPaths rejects paths served twice, which http.ServeMux would panic on.
+func (s *Server) checkPaths() error {
+	if s.metricsPath == s.livenessPath || s.metricsPath == s.readinessPath || s.livenessPath == s.readinessPath {
+		return errors.New(fmt.Sprintf("metrics, liveness and readiness paths must differ: %s, %s, %s",
+			s.metricsPath, s.livenessPath, s.readinessPath))
+	}
+	return nil
+}
+
+// NewServer creates a server exposing the collector gatherer. It does not listen until Start.
+func (c *Collector) NewServer(options ...ServerOption) (*Server, error) {
+	s := &Server{
+		collector:       c,
+		address:         defaultListenAddress,
+		metricsPath:     defaultMetricsPath,
+		livenessPath:    defaultLivenessPath,
+		readinessPath:   defaultReadinessPath,
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkPaths(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handler returns the handler serving metrics and health endpoints,
+// usable with httptest.NewServer without starting the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(s.metricsPath, s.basicAuth(promhttp.HandlerFor(s.collector.gatherer, promhttp.HandlerOpts{
+		ErrorHandling:      promhttp.ContinueOnError,
+		DisableCompression: s.disableCompression,
+		EnableOpenMetrics:  !s.disableOpenMetrics,
+	})))
+	mux.HandleFunc(s.livenessPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc(s.readinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&s.shuttingDown) == 1 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if s.readinessCheck != nil {
+			if err := s.readinessCheck(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+func (s *Server) basicAuth(handler http.Handler) http.Handler {
+	if s.basicAuthUser == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(s.basicAuthUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(s.basicAuthPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Start listens on the address and serves in the background until the context is done,
+// then shuts the server down gracefully. Listen errors are returned immediately.
+func (s *Server) Start(ctx context.Context) error {
+	defer s.mtx.Unlock()
+	s.mtx.Lock()
+
+	if s.httpServer != nil {
+		return errors.New("server is already started")
+	}
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.listener = listener
+	s.httpServer = &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	s.done = make(chan error, 1)
+	s.stopped = make(chan struct{})
+	atomic.StoreInt32(&s.shuttingDown, 0)
+
+	httpServer, done, stopped := s.httpServer, s.done, s.stopped
+	go func() {
+		err := httpServer.Serve(listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		done <- err
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+			defer cancel()
+			_ = s.Shutdown(shutdownCtx)
+		case <-stopped:
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on, which is useful with port 0. It is nil before Start.
+func (s *Server) Addr() net.Addr {
+	defer s.mtx.Unlock()
+	s.mtx.Lock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Shutdown stops the server waiting for in-flight requests until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.mtx.Unlock()
+	s.mtx.Lock()
+
+	if s.httpServer == nil {
+		return nil
+	}
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	err := s.httpServer.Shutdown(ctx)
+	if serveErr := <-s.done; err == nil {
+		err = serveErr
+	}
+	close(s.stopped)
+	s.httpServer = nil
+	s.listener = nil
+	return err
+}
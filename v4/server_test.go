@@ -0,0 +1,201 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServerRejectsDuplicatePaths(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, options := range map[string][]ServerOption{
+		"health path equal to the metrics path": {WithHealthPaths("/metrics", "/readyz")},
+		"equal health paths":                    {WithHealthPaths("/health", "/health")},
+		"metrics path set after health paths":   {WithHealthPaths("/live", "/ready"), WithMetricsPath("/ready")},
+	} {
+		if _, err := c.NewServer(options...); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+	if _, err := c.NewServer(WithMetricsPath("/healthz"), WithHealthPaths("/live", "/ready")); err != nil {
+		t.Errorf("default liveness path replaced by a later option: %v", err)
+	}
+}
+
+func TestServerHandler(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	server, err := c.NewServer(WithMetricsPath("/internal/metrics"), WithHealthPaths("/live", "/ready"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	for _, path := range []string{"/internal/metrics", "/live", "/ready"} {
+		resp, err := http.Get(httpServer.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestServerBasicAuth(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := c.NewServer(WithBasicAuth("prometheus", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	for _, test := range []struct {
+		name     string
+		path     string
+		user     string
+		password string
+		status   int
+	}{
+		{name: "no credentials", path: "/metrics", status: http.StatusUnauthorized},
+		{name: "wrong password", path: "/metrics", user: "prometheus", password: "wrong", status: http.StatusUnauthorized},
+		{name: "credentials", path: "/metrics", user: "prometheus", password: "secret", status: http.StatusOK},
+		{name: "health without credentials", path: "/healthz", status: http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+		if challenge := resp.Header.Get("WWW-Authenticate"); (test.status == http.StatusUnauthorized) != (challenge != "") {
+			t.Errorf("%s: WWW-Authenticate %q", test.name, challenge)
+		}
+	}
+}
+
+func TestServerReadinessCheck(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ready int32
+	server, err := c.NewServer(WithReadinessCheck(func() error {
+		if atomic.LoadInt32(&ready) == 0 {
+			return errors.New("warming up")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	status := func(path string) int {
+		resp, err := http.Get(httpServer.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readiness while the check fails: %d", code)
+	}
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("liveness while the readiness check fails: %d", code)
+	}
+	atomic.StoreInt32(&ready, 1)
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Errorf("readiness once the check passes: %d", code)
+	}
+}
+
+func TestServerStopsWhenContextIsDone(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := c.NewServer(WithListenAddress("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := server.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(ctx); err == nil {
+		t.Error("want an error starting twice")
+	}
+
+	url := "http://" + server.Addr().String() + "/metrics"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d", resp.StatusCode)
+	}
+
+	cancel()
+	waitFor(t, "the server to shut down", func() bool { return server.Addr() == nil })
+	if _, err := http.Get(url); err == nil {
+		t.Error("want the server to stop listening")
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown after the context shutdown: %v", err)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	c, err := NewCollectorWithOptions("pod", "ns", "sub", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := c.NewServer(WithListenAddress("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("restarting after Shutdown: %v", err)
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
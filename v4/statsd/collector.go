@@ -0,0 +1,373 @@
+// Package statsd implements interfaces.Collector on top of StatsD with DogStatsD tags for labels.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	prometheus_metrics "github.com/ifrolikov/prometheus_metrics/v4"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	udpMaxPacketSize = 1432
+	udsMaxPacketSize = 8192
+)
+
+// Collector buffers observations and sends them to a StatsD agent every flush interval.
+// Counters are summed and gauges keep the last value between flushes unless aggregation is disabled,
+// timings and histograms are always sent as observed.
+type Collector struct {
+	conn              net.Conn
+	prefix            string
+	constTags         map[string]string
+	flushInterval     time.Duration
+	aggregate         bool
+	maxPacketSize     int
+	histogramType     HistogramType
+	gaugeTTL          time.Duration
+	contextLabelNames map[string][]string
+	missingLabelValue string
+	errorHandler      func(err error)
+
+	mtx      sync.Mutex
+	counters map[string]float64
+	// gauges keep values between flushes, so AddGauge and SubGauge are relative to the last set value.
+	gauges        map[string]float64
+	gaugeUpdates  map[string]time.Time
+	changedGauges map[string]struct{}
+	lines         []string
+	stop          chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+	closeErr      error
+}
+
+// NewCollector connects to the agent at the address: host:port or udp://host:port for UDP,
+// unix:///path/to/socket for a datagram Unix domain socket.
+func NewCollector(address string, options ...Option) (*Collector, error) {
+	network, path := "udp", strings.TrimPrefix(address, "udp://")
+	maxPacketSize := udpMaxPacketSize
+	if strings.HasPrefix(address, "unix://") {
+		network, path = "unixgram", strings.TrimPrefix(address, "unix://")
+		maxPacketSize = udsMaxPacketSize
+	}
+
+	c := &Collector{
+		constTags:         make(map[string]string),
+		flushInterval:     time.Second,
+		aggregate:         true,
+		maxPacketSize:     maxPacketSize,
+		contextLabelNames: make(map[string][]string),
+		counters:          make(map[string]float64),
+		gauges:            make(map[string]float64),
+		gaugeUpdates:      make(map[string]time.Time),
+		changedGauges:     make(map[string]struct{}),
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := net.Dial(network, path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to statsd at %s: %w", address, err)
+	}
+	c.conn = conn
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(c.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.handleError(c.Flush())
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (c *Collector) ObserveTimer(name string, startTime time.Time, labels map[string]string) error {
+	return c.observe(name, durationMilliseconds(startTime), "ms", labels)
+}
+
+// ObserveHistogram sends the duration in milliseconds as a histogram or a distribution.
+func (c *Collector) ObserveHistogram(name string, startTime time.Time, labels map[string]string) error {
+	metricType := "h"
+	if c.histogramType == Distribution {
+		metricType = "d"
+	}
+	return c.observe(name, durationMilliseconds(startTime), metricType, labels)
+}
+
+func (c *Collector) ObserveCounter(name string, inc int, labels map[string]string) error {
+	return c.ObserveCounterFloat(name, float64(inc), labels)
+}
+
+func (c *Collector) ObserveCounterFloat(name string, inc float64, labels map[string]string) error {
+	if inc < 0 {
+		return fmt.Errorf("%w: %s by %v", prometheus_metrics.ErrCounterDecrease, name, inc)
+	}
+	if !c.aggregate {
+		return c.observe(name, inc, "c", labels)
+	}
+	key := c.line(name, labels)
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	c.counters[key] += inc
+	return nil
+}
+
+// ObserveGauge sets the gauge to the passed value.
+func (c *Collector) ObserveGauge(name string, inc int, labels map[string]string) error {
+	return c.SetGauge(name, float64(inc), labels)
+}
+
+func (c *Collector) SetGauge(name string, value float64, labels map[string]string) error {
+	return c.updateGauge(name, labels, func(float64) float64 { return value })
+}
+
+func (c *Collector) AddGauge(name string, value float64, labels map[string]string) error {
+	return c.updateGauge(name, labels, func(current float64) float64 { return current + value })
+}
+
+func (c *Collector) SubGauge(name string, value float64, labels map[string]string) error {
+	return c.updateGauge(name, labels, func(current float64) float64 { return current - value })
+}
+
+func (c *Collector) IncGauge(name string, labels map[string]string) error {
+	return c.AddGauge(name, 1, labels)
+}
+
+func (c *Collector) DecGauge(name string, labels map[string]string) error {
+	return c.SubGauge(name, 1, labels)
+}
+
+func (c *Collector) SetGaugeToCurrentTime(name string, labels map[string]string) error {
+	return c.SetGauge(name, float64(time.Now().UnixNano())/1e9, labels)
+}
+
+func (c *Collector) ObserveTimerCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveTimer(name, startTime, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveHistogramCtx(ctx context.Context, name string, startTime time.Time, labels map[string]string) error {
+	return c.ObserveHistogram(name, startTime, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveCounterCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return c.ObserveCounter(name, inc, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveCounterFloatCtx(ctx context.Context, name string, inc float64, labels map[string]string) error {
+	return c.ObserveCounterFloat(name, inc, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) ObserveGaugeCtx(ctx context.Context, name string, inc int, labels map[string]string) error {
+	return c.ObserveGauge(name, inc, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) SetGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.SetGauge(name, value, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) AddGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.AddGauge(name, value, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) SubGaugeCtx(ctx context.Context, name string, value float64, labels map[string]string) error {
+	return c.SubGauge(name, value, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) IncGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.IncGauge(name, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) DecGaugeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.DecGauge(name, c.contextLabels(ctx, name, labels))
+}
+
+func (c *Collector) SetGaugeToCurrentTimeCtx(ctx context.Context, name string, labels map[string]string) error {
+	return c.SetGaugeToCurrentTime(name, c.contextLabels(ctx, name, labels))
+}
+
+// Flush sends everything buffered since the last flush.
+func (c *Collector) Flush() error {
+	c.mtx.Lock()
+	lines := c.lines
+	c.lines = nil
+	for key, value := range c.counters {
+		lines = append(lines, formatLine(key, value, "c"))
+	}
+	c.counters = make(map[string]float64)
+	for key := range c.changedGauges {
+		lines = append(lines, gaugeLines(key, c.gauges[key])...)
+	}
+	c.changedGauges = make(map[string]struct{})
+	c.forgetStaleGauges()
+	c.mtx.Unlock()
+
+	var errs []string
+	for _, packet := range packets(lines, c.maxPacketSize) {
+		if _, err := c.conn.Write([]byte(packet)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(fmt.Sprintf("statsd flush failed: %s", strings.Join(errs, "; ")))
+	}
+	return nil
+}
+
+// Close stops periodic flushes, flushes the buffered metrics and closes the connection.
+// Later calls do nothing and return the result of the first one.
+func (c *Collector) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		c.closeErr = c.Flush()
+		if err := c.conn.Close(); c.closeErr == nil {
+			c.closeErr = err
+		}
+	})
+	return c.closeErr
+}
+
+func (c *Collector) observe(name string, value float64, metricType string, labels map[string]string) error {
+	line := formatLine(c.line(name, labels), value, metricType)
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	c.lines = append(c.lines, line)
+	return nil
+}
+
+func (c *Collector) updateGauge(name string, labels map[string]string, update func(current float64) float64) error {
+	key := c.line(name, labels)
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	value := update(c.gauges[key])
+	c.gauges[key] = value
+	if c.gaugeTTL > 0 {
+		c.gaugeUpdates[key] = time.Now()
+	}
+	if c.aggregate {
+		c.changedGauges[key] = struct{}{}
+	} else {
+		c.lines = append(c.lines, gaugeLines(key, value)...)
+	}
+	return nil
+}
+
+// forgetStaleGauges drops the values of gauges not updated for the gauge TTL, so label tuples
+// that are gone do not keep memory. It must be called with the lock held.
+func (c *Collector) forgetStaleGauges() {
+	if c.gaugeTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	for key, updated := range c.gaugeUpdates {
+		if now.Sub(updated) > c.gaugeTTL {
+			delete(c.gauges, key)
+			delete(c.gaugeUpdates, key)
+		}
+	}
+}
+
+func (c *Collector) handleError(err error) {
+	if err != nil && c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
+
+// line returns the metric name with the tags, the value and the type are added by formatLine.
+// It is used as the aggregation key as well.
+func (c *Collector) line(name string, labels map[string]string) string {
+	tags := make([]string, 0, len(c.constTags)+len(labels))
+	for tagName, value := range c.constTags {
+		if _, ok := labels[tagName]; !ok {
+			tags = append(tags, tagName+":"+sanitizeTag(value))
+		}
+	}
+	for labelName, value := range labels {
+		tags = append(tags, sanitizeName(labelName)+":"+sanitizeTag(value))
+	}
+	sort.Strings(tags)
+	if len(tags) == 0 {
+		return c.prefix + sanitizeName(name)
+	}
+	return c.prefix + sanitizeName(name) + "|#" + strings.Join(tags, ",")
+}
+
+func formatLine(key string, value float64, metricType string) string {
+	formatted := strconv.FormatFloat(value, 'f', -1, 64) + "|" + metricType
+	if i := strings.Index(key, "|#"); i >= 0 {
+		return key[:i] + ":" + formatted + key[i:]
+	}
+	return key + ":" + formatted
+}
+
+// gaugeLines sets the gauge to the value. StatsD reads a signed value as a change of the gauge,
+// so a negative value is sent after resetting the gauge to 0.
+func gaugeLines(key string, value float64) []string {
+	if value < 0 {
+		return []string{formatLine(key, 0, "g"), formatLine(key, value, "g")}
+	}
+	return []string{formatLine(key, value, "g")}
+}
+
+var (
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_")
+	tagReplacer  = strings.NewReplacer("|", "_", ",", "_", "\n", "_")
+)
+
+// sanitizeName replaces the characters delimiting the parts of a line in metric and tag names.
+func sanitizeName(name string) string {
+	return nameReplacer.Replace(name)
+}
+
+func sanitizeTag(value string) string {
+	return tagReplacer.Replace(value)
+}
+
+func durationMilliseconds(startTime time.Time) float64 {
+	return float64(time.Since(startTime)) / float64(time.Millisecond)
+}
+
+// packets joins lines with newlines into packets of up to maxSize bytes. Longer lines are sent alone.
+func packets(lines []string, maxSize int) []string {
+	var result []string
+	var packet strings.Builder
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxSize {
+			result = append(result, packet.String())
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		result = append(result, packet.String())
+	}
+	return result
+}
+
+func (c *Collector) contextLabels(ctx context.Context, name string, labels map[string]string) map[string]string {
+	return prometheus_metrics.MergeContextLabels(ctx, c.contextLabelNames[name], c.missingLabelValue, labels)
+}
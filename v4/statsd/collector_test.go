@@ -0,0 +1,195 @@
+package statsd
+
+import (
+	"context"
+	prometheus_metrics "github.com/ifrolikov/prometheus_metrics/v4"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen returns the address of a local UDP agent and a func reading the lines of the next packet in order.
+func listen(t *testing.T) (string, func() []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String(), func() []string {
+		buf := make([]byte, udsMaxPacketSize)
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(string(buf[:n]), "\n")
+	}
+}
+
+func sorted(lines []string) []string {
+	sort.Strings(lines)
+	return lines
+}
+
+func TestLineSanitizesNames(t *testing.T) {
+	address, read := listen(t)
+	c, err := NewCollector(address, WithPrefix("name:space", "sub"), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.ObserveCounter("requests|total#1", 2, map[string]string{"route:name": "/a|b,c", "code,class@x": "2xx"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "name_space.sub.requests_total_1:2|c|#code_class_x:2xx,route_name:/a_b_c"
+	if lines := read(); len(lines) != 1 || lines[0] != want {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestCountersAreSummedBetweenFlushes(t *testing.T) {
+	address, read := listen(t)
+	c, err := NewCollector(address, WithTags(map[string]string{"podname": "pod"}), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := c.ObserveCounter("requests", 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddGauge("queue", 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SubGauge("queue", 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"queue:3|g|#podname:pod", "requests:3|c|#podname:pod"}
+	if lines := sorted(read()); strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestContextLabelsUseMissingLabelValue(t *testing.T) {
+	address, read := listen(t)
+	c, err := NewCollector(address,
+		WithContextLabels("requests", "tenant"),
+		WithMissingLabelValue("unknown"),
+		WithoutAggregation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := prometheus_metrics.ContextWithLabels(context.Background(), map[string]string{"tenant": "acme"})
+	if err := c.ObserveCounterCtx(ctx, "requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounterCtx(context.Background(), "requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"requests:1|c|#tenant:acme", "requests:1|c|#tenant:unknown"}
+	if lines := sorted(read()); strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestCloseFlushesOnce(t *testing.T) {
+	address, read := listen(t)
+	c, err := NewCollector(address, WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveCounter("requests", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := read(); len(lines) != 1 || lines[0] != "requests:1|c" {
+		t.Errorf("lines = %q, want the final flush", lines)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestNegativeGaugesAreResetFirst(t *testing.T) {
+	for name, options := range map[string][]Option{
+		"aggregated":     {WithFlushInterval(time.Hour)},
+		"not aggregated": {WithFlushInterval(time.Hour), WithoutAggregation()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			address, read := listen(t)
+			c, err := NewCollector(address, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if err := c.SetGauge("balance", -5, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"balance:0|g", "balance:-5|g"}
+			if lines := read(); strings.Join(lines, "\n") != strings.Join(want, "\n") {
+				t.Errorf("lines = %q, want %q", lines, want)
+			}
+		})
+	}
+}
+
+func TestGaugeTTLForgetsStaleValues(t *testing.T) {
+	address, read := listen(t)
+	c, err := NewCollector(address, WithFlushInterval(time.Hour), WithGaugeTTL(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.SetGauge("queue", 5, map[string]string{"shard": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	read()
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mtx.Lock()
+	remembered := len(c.gauges)
+	c.mtx.Unlock()
+	if remembered != 0 {
+		t.Errorf("remembered %d gauges, want the stale one forgotten", remembered)
+	}
+	if err := c.AddGauge("queue", 1, map[string]string{"shard": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := read(); len(lines) != 1 || lines[0] != "queue:1|g|#shard:1" {
+		t.Errorf("lines = %q, want the gauge to start from 0", lines)
+	}
+}
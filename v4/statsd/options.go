@@ -0,0 +1,123 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Option func(c *Collector) error
+
+type HistogramType int
+
+const (
+	// Histogram sends ObserveHistogram values as DogStatsD histograms aggregated by the agent.
+	Histogram HistogramType = iota
+	// Distribution sends ObserveHistogram values as DogStatsD distributions aggregated server-side.
+	Distribution
+)
+
+// WithPrefix prepends namespace.subsystem. to every metric name, skipping empty parts.
+func WithPrefix(namespace string, subsystem string) Option {
+	return func(c *Collector) error {
+		c.prefix = ""
+		for _, part := range []string{namespace, subsystem} {
+			if part != "" {
+				c.prefix += sanitizeName(part) + "."
+			}
+		}
+		return nil
+	}
+}
+
+// WithTags adds the tags to every metric, e.g. the pod name.
+func WithTags(tags map[string]string) Option {
+	return func(c *Collector) error {
+		for name, value := range tags {
+			if strings.ContainsAny(name, ":|,#") {
+				return errors.New(fmt.Sprintf("invalid tag name: %s", name))
+			}
+			c.constTags[name] = value
+		}
+		return nil
+	}
+}
+
+// WithFlushInterval sets how often buffered metrics are sent, every second by default.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(c *Collector) error {
+		if interval <= 0 {
+			return errors.New(fmt.Sprintf("flush interval must be positive: %s", interval))
+		}
+		c.flushInterval = interval
+		return nil
+	}
+}
+
+// WithoutAggregation sends every counter and gauge observation instead of a single value per flush.
+func WithoutAggregation() Option {
+	return func(c *Collector) error {
+		c.aggregate = false
+		return nil
+	}
+}
+
+// WithMaxPacketSize limits the size of a datagram, 1432 bytes for UDP and 8192 bytes for UDS by default.
+func WithMaxPacketSize(size int) Option {
+	return func(c *Collector) error {
+		if size <= 0 {
+			return errors.New(fmt.Sprintf("max packet size must be positive: %d", size))
+		}
+		c.maxPacketSize = size
+		return nil
+	}
+}
+
+// WithHistogramType selects the DogStatsD type ObserveHistogram is sent as, Histogram by default.
+func WithHistogramType(histogramType HistogramType) Option {
+	return func(c *Collector) error {
+		if histogramType != Histogram && histogramType != Distribution {
+			return errors.New(fmt.Sprintf("unknown histogram type: %d", histogramType))
+		}
+		c.histogramType = histogramType
+		return nil
+	}
+}
+
+// WithGaugeTTL forgets the value of a gauge label tuple not updated for the ttl, the values are kept forever by default.
+// AddGauge and SubGauge on a forgotten gauge start from 0.
+func WithGaugeTTL(ttl time.Duration) Option {
+	return func(c *Collector) error {
+		if ttl <= 0 {
+			return errors.New(fmt.Sprintf("gauge ttl must be positive: %s", ttl))
+		}
+		c.gaugeTTL = ttl
+		return nil
+	}
+}
+
+// WithContextLabels allows Ctx observations of the metric to take the label names from the context.
+// The tags are always sent, with the WithMissingLabelValue value if the context does not have them.
+func WithContextLabels(name string, labelNames ...string) Option {
+	return func(c *Collector) error {
+		c.contextLabelNames[name] = append(c.contextLabelNames[name], labelNames...)
+		return nil
+	}
+}
+
+// WithMissingLabelValue sets the value of context labels missing from the context, empty by default.
+func WithMissingLabelValue(value string) Option {
+	return func(c *Collector) error {
+		c.missingLabelValue = value
+		return nil
+	}
+}
+
+// WithErrorHandler is called when a flush fails to send a packet.
+func WithErrorHandler(handler func(err error)) Option {
+	return func(c *Collector) error {
+		c.errorHandler = handler
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package prometheus_metrics
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SummaryConfig describes how the summary behind a timer metric is built.
+// Zero fields are taken from the collector default config; use an empty non-nil
+// Objectives map to get a summary without quantiles.
+type SummaryConfig struct {
+	Objectives map[float64]float64
+	MaxAge     time.Duration
+	AgeBuckets uint32
+	BufCap     uint32
+}
+
+func (s SummaryConfig) withDefaults(defaults SummaryConfig) SummaryConfig {
+	if s.Objectives == nil {
+		s.Objectives = defaults.Objectives
+	}
+	if s.MaxAge == 0 {
+		s.MaxAge = defaults.MaxAge
+	}
+	if s.AgeBuckets == 0 {
+		s.AgeBuckets = defaults.AgeBuckets
+	}
+	if s.BufCap == 0 {
+		s.BufCap = defaults.BufCap
+	}
+	return s
+}
+
+func (s SummaryConfig) copy() SummaryConfig {
+	if s.Objectives != nil {
+		objectives := make(map[float64]float64, len(s.Objectives))
+		for quantile, epsilon := range s.Objectives {
+			objectives[quantile] = epsilon
+		}
+		s.Objectives = objectives
+	}
+	return s
+}
+
+func validateSummaryConfig(config SummaryConfig) error {
+	if config.MaxAge < 0 {
+		return errors.New(fmt.Sprintf("summary max age must not be negative: %s", config.MaxAge))
+	}
+	for quantile, epsilon := range config.Objectives {
+		if quantile < 0 || quantile > 1 {
+			return errors.New(fmt.Sprintf("summary objective quantile must be in [0, 1]: %v", quantile))
+		}
+		if epsilon < 0 || epsilon > 1 {
+			return errors.New(fmt.Sprintf("summary objective error must be in [0, 1]: %v", epsilon))
+		}
+	}
+	return nil
+}
+
+func equalSummaryConfigs(a SummaryConfig, b SummaryConfig) bool {
+	if a.MaxAge != b.MaxAge || a.AgeBuckets != b.AgeBuckets || a.BufCap != b.BufCap {
+		return false
+	}
+	if len(a.Objectives) != len(b.Objectives) {
+		return false
+	}
+	for quantile, epsilon := range a.Objectives {
+		if otherEpsilon, ok := b.Objectives[quantile]; !ok || otherEpsilon != epsilon {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestSummaryConfigDefaultsDoNotDependOnOptionOrder(t *testing.T) {
+	objectives := map[float64]float64{0.95: 0.01}
+	c, err := NewCollectorWithOptions("pod", "ns", "sub",
+		WithRegistry(prometheus.NewRegistry()),
+		WithSummaryConfig("timer", SummaryConfig{Objectives: objectives}),
+		WithDefaultSummaryConfig(SummaryConfig{MaxAge: 30 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ObserveTimer("timer", time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	config := c.summaryConfigMap["timer"]
+	if config.MaxAge != 30*time.Second {
+		t.Errorf("max age = %s, want the default 30s", config.MaxAge)
+	}
+	if len(config.Objectives) != 1 || config.Objectives[0.95] != 0.01 {
+		t.Errorf("objectives = %v, want the declared %v", config.Objectives, objectives)
+	}
+	if err := c.DeclareSummaryConfig("timer", SummaryConfig{Objectives: objectives, MaxAge: 30 * time.Second}); err != nil {
+		t.Errorf("declaring the effective config again: %v", err)
+	}
+	if err := c.DeclareSummaryConfig("timer", SummaryConfig{MaxAge: time.Minute}); err == nil {
+		t.Error("declaring a different config must fail")
+	}
+}
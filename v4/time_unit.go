@@ -0,0 +1,74 @@
+package prometheus_metrics
+
+import (
+	"strings"
+	"time"
+)
+
+type TimeUnit int
+
+const (
+	// TimeUnitSeconds records durations in seconds into "<name>_seconds" metrics.
+	TimeUnitSeconds TimeUnit = iota
+	// TimeUnitLegacyNanoseconds keeps the pre-seconds behaviour: timers record nanoseconds
+	// and histograms record seconds, both under the name passed by the caller.
+	TimeUnitLegacyNanoseconds
+	// TimeUnitSecondsAndLegacy emits both series side-by-side for the dashboards migration period.
+	TimeUnitSecondsAndLegacy
+)
+
+const secondsSuffix = "_seconds"
+
+type durationMetric struct {
+	name        string
+	nanoseconds bool
+}
+
+func (m durationMetric) value(duration time.Duration) float64 {
+	if m.nanoseconds {
+		return float64(duration)
+	}
+	return duration.Seconds()
+}
+
+func secondsMetricName(name string) string {
+	if strings.HasSuffix(name, secondsSuffix) {
+		return name
+	}
+	return name + secondsSuffix
+}
+
+// durationMetrics returns the series a duration observation goes to. Legacy timers were recorded
+// in nanoseconds while legacy histograms were already in seconds. The result is cached
+// so that the observation path does not build metric names on every call.
+func (c *Collector) durationMetrics(name string, legacyNanoseconds bool) []durationMetric {
+	cache := &c.histogramDurationMetrics
+	if legacyNanoseconds {
+		cache = &c.timerDurationMetrics
+	}
+	if metrics, ok := cache.load(name); ok {
+		return metrics.([]durationMetric)
+	}
+
+	defer c.mtx.Unlock()
+	c.mtx.Lock()
+
+	metrics := c.newDurationMetrics(name, legacyNanoseconds)
+	cache.store(name, metrics)
+	return metrics
+}
+
+func (c *Collector) newDurationMetrics(name string, legacyNanoseconds bool) []durationMetric {
+	secondsMetric := durationMetric{name: secondsMetricName(name)}
+	legacyMetric := durationMetric{name: name, nanoseconds: legacyNanoseconds}
+
+	switch c.timeUnit {
+	case TimeUnitLegacyNanoseconds:
+		return []durationMetric{legacyMetric}
+	case TimeUnitSecondsAndLegacy:
+		if legacyMetric.name != secondsMetric.name {
+			return []durationMetric{secondsMetric, legacyMetric}
+		}
+	}
+	return []durationMetric{secondsMetric}
+}
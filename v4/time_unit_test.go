@@ -0,0 +1,97 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"testing"
+	"time"
+)
+
+type durationSum struct {
+	metricType dto.MetricType
+	sum        float64
+}
+
+// durationSums returns the type and the sum of the single series of every gathered summary and histogram.
+func durationSums(t *testing.T, gatherer prometheus.Gatherer) map[string]durationSum {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := make(map[string]durationSum)
+	for _, mf := range mfs {
+		switch mf.GetType() {
+		case dto.MetricType_SUMMARY:
+			sums[mf.GetName()] = durationSum{mf.GetType(), mf.Metric[0].GetSummary().GetSampleSum()}
+		case dto.MetricType_HISTOGRAM:
+			sums[mf.GetName()] = durationSum{mf.GetType(), mf.Metric[0].GetHistogram().GetSampleSum()}
+		}
+	}
+	return sums
+}
+
+func TestTimeUnits(t *testing.T) {
+	summary, histogram := dto.MetricType_SUMMARY, dto.MetricType_HISTOGRAM
+	for _, test := range []struct {
+		name    string
+		options []Option
+		want    map[string]durationSum
+	}{
+		{
+			name: "seconds by default",
+			want: map[string]durationSum{
+				"ns_sub_request_seconds": {summary, 1.5},
+				"ns_sub_latency_seconds": {histogram, 1.5},
+				"ns_sub_wait_seconds":    {summary, 1.5},
+			},
+		},
+		{
+			name:    "legacy nanoseconds",
+			options: []Option{WithTimeUnit(TimeUnitLegacyNanoseconds)},
+			want: map[string]durationSum{
+				"ns_sub_request":      {summary, 1.5e9},
+				"ns_sub_latency":      {histogram, 1.5},
+				"ns_sub_wait_seconds": {summary, 1.5e9},
+			},
+		},
+		{
+			name:    "seconds and legacy",
+			options: []Option{WithTimeUnit(TimeUnitSecondsAndLegacy)},
+			want: map[string]durationSum{
+				"ns_sub_request_seconds": {summary, 1.5},
+				"ns_sub_request":         {summary, 1.5e9},
+				"ns_sub_latency_seconds": {histogram, 1.5},
+				"ns_sub_latency":         {histogram, 1.5},
+				"ns_sub_wait_seconds":    {summary, 1.5},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			c, err := NewCollectorWithOptions("pod", "ns", "sub", append([]Option{WithRegistry(registry)}, test.options...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			duration := 1500 * time.Millisecond
+			if err := c.ObserveTimerDuration("request", duration, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.ObserveHistogramDuration("latency", duration, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.ObserveTimerDuration("wait_seconds", duration, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			sums := durationSums(t, registry)
+			if len(sums) != len(test.want) {
+				t.Errorf("gathered %v, want %v", sums, test.want)
+			}
+			for name, want := range test.want {
+				if got, ok := sums[name]; !ok || got != want {
+					t.Errorf("%s = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}